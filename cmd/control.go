@@ -0,0 +1,30 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	tools "github.com/mparvin/run4ever/tools"
+)
+
+// controlJobs applies action to every running job matching query and reports
+// each result, exiting with status 1 when any of them failed
+func controlJobs(query string, done string, action func(job tools.JobState) error) {
+	jobs, err := tools.FindRunningJobs(query)
+	if err != nil {
+		log.Fatal(err)
+	}
+	failed := false
+	for _, job := range jobs {
+		if err := action(job); err != nil {
+			log.Print(err)
+			failed = true
+			continue
+		}
+		fmt.Printf("%s job %s (PID %d)\n", done, job.JobID, job.PID)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"log"
+	"os"
+
+	tools "github.com/mparvin/run4ever/tools"
+	"github.com/spf13/cobra"
+)
+
+var (
+	historyJSON   bool
+	historyLimit  int
+	historyCmdDir string
+)
+
+// historyCmd shows the recorded runs of a job
+var historyCmd = &cobra.Command{
+	Use:   "history [flags] <job-id|name>",
+	Short: "Show the recorded runs of a job",
+	Long: `Show a record of each run of a job: start time, duration, exit code, signal, timeout,
+retry count and the number of bytes written to stdout and stderr.
+
+The job can be given by name, by full job ID or by any unique prefix of the job ID shown by --ps.`,
+	Example: `run4ever history 3f2a
+run4ever history --limit 20 --json 3f2a`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		records, err := tools.ReadHistory(historyCmdDir, args[0], historyLimit)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := tools.PrintHistory(os.Stdout, records, historyJSON); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(historyCmd)
+
+	historyCmd.Flags().BoolVar(&historyJSON, "json", false, "Print the records as JSON")
+	historyCmd.Flags().IntVarP(&historyLimit, "limit", "n", 0, "Only show the latest runs, 0 for all")
+	historyCmd.Flags().StringVar(&historyCmdDir, "history-dir", tools.GetHistoryDir(), "Directory where the run history is stored")
+}
@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"time"
+
+	tools "github.com/mparvin/run4ever/tools"
+	"github.com/spf13/cobra"
+)
+
+var killTimeout time.Duration
+
+// killCmd kills a running job without waiting for its command
+var killCmd = &cobra.Command{
+	Use:   "kill [flags] <job-id|name|tag>",
+	Short: "Kill a running job",
+	Long: `Ask the run4ever process of a job to kill its running command with SIGKILL and exit at
+once. If it does not exit within --timeout, the run4ever process itself is killed and its
+entry removed from the state file.
+
+The job can be given by name, by full job ID or by any unique prefix of the job ID shown by --ps.
+Given a tag, every running job with that tag is killed.`,
+	Example: `run4ever kill 3f2a`,
+	Args:    cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		controlJobs(args[0], "Killed", func(job tools.JobState) error {
+			return tools.KillJob(job, killTimeout)
+		})
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(killCmd)
+
+	killCmd.Flags().DurationVar(&killTimeout, "timeout", 5*time.Second, "How long to wait for the job to exit before killing run4ever itself")
+}
@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"log"
+	"os"
+
+	tools "github.com/mparvin/run4ever/tools"
+	"github.com/spf13/cobra"
+)
+
+var logsOptions tools.LogsOptions
+
+// logsCmd shows the stored output of a job
+var logsCmd = &cobra.Command{
+	Use:   "logs [flags] <job-id|name>",
+	Short: "Show the output of a job",
+	Long: `Show the stdout and stderr stored for a job, including rotated log files.
+
+The job can be given by name, by full job ID or by any unique prefix of the job ID shown by --ps.
+Jobs that are no longer running can be shown as long as their output is stored.`,
+	Example: `run4ever logs 3f2a
+run4ever logs -f --tail 50 3f2a
+run4ever logs --run 4 --stderr-only 3f2a`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := tools.ShowLogs(args[0], logsOptions, os.Stdout, os.Stderr); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(logsCmd)
+
+	logsCmd.Flags().BoolVarP(&logsOptions.Follow, "follow", "f", false, "Keep printing new output until the job ends")
+	logsCmd.Flags().IntVarP(&logsOptions.Tail, "tail", "n", -1, "Number of lines to show from the end of the logs, -1 for all")
+	logsCmd.Flags().IntVar(&logsOptions.Run, "run", 0, "Only show the output of this run number, 0 for all runs")
+	logsCmd.Flags().DurationVar(&logsOptions.Since, "since", 0, "Only show output newer than this, e.g. 1h")
+	logsCmd.Flags().BoolVar(&logsOptions.StderrOnly, "stderr-only", false, "Only show lines written to stderr")
+	logsCmd.Flags().StringVar(&logsOptions.Dir, "log-dir", tools.GetLogDir(), "Directory where the output of jobs is stored")
+}
@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	tools "github.com/mparvin/run4ever/tools"
+	"github.com/spf13/cobra"
+)
+
+var pruneOptions tools.PruneOptions
+
+// pruneCmd removes the state entries of jobs whose process is gone
+var pruneCmd = &cobra.Command{
+	Use:   "prune [flags]",
+	Short: "Remove stale jobs from the state file",
+	Long: `Remove the entries of jobs whose process is gone, for example because it was killed
+with SIGKILL, from the state file shown by --ps and -l.
+
+With --archive the removed entries are appended to ~/.run4ever/state-archive.jsonl.`,
+	Example: `run4ever prune
+run4ever prune --older-than 24h --archive
+run4ever prune --dry-run`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if pruneOptions.OlderThan < 0 {
+			log.Fatal("--older-than must not be negative")
+		}
+		pruned, err := tools.PruneStaleJobs(pruneOptions)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(pruned) == 0 {
+			fmt.Println("No stale jobs found.")
+			return
+		}
+		if err := tools.PrintPrunedJobs(os.Stdout, pruned); err != nil {
+			log.Fatal(err)
+		}
+		switch {
+		case pruneOptions.DryRun:
+			fmt.Printf("Would remove %d stale job(s)\n", len(pruned))
+		case pruneOptions.Archive:
+			fmt.Printf("Archived %d stale job(s) to %s\n", len(pruned), tools.GetStateArchiveFile())
+		default:
+			fmt.Printf("Removed %d stale job(s)\n", len(pruned))
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(pruneCmd)
+
+	pruneCmd.Flags().DurationVar(&pruneOptions.OlderThan, "older-than", 0, "Only remove jobs without activity for this long, e.g. 24h (default all stale jobs)")
+	pruneCmd.Flags().BoolVar(&pruneOptions.Archive, "archive", false, "Append the removed entries to ~/.run4ever/state-archive.jsonl")
+	pruneCmd.Flags().BoolVar(&pruneOptions.DryRun, "dry-run", false, "Show the stale jobs without removing them")
+}
@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"time"
+
+	tools "github.com/mparvin/run4ever/tools"
+	"github.com/spf13/cobra"
+)
+
+var restartTimeout time.Duration
+
+// restartCmd starts a fresh run of a running job
+var restartCmd = &cobra.Command{
+	Use:   "restart [flags] <job-id|name|tag>",
+	Short: "Restart the command of a running job",
+	Long: `Ask the run4ever process of a job to stop the running command and start a fresh run
+right away, as --hup-restart does. The job keeps its retry count and backoff delay, and
+the interrupted run is not counted as a failure.
+
+The job can be given by name, by full job ID or by any unique prefix of the job ID shown by --ps.
+Given a tag, every running job with that tag is restarted.`,
+	Example: `run4ever restart 3f2a`,
+	Args:    cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		controlJobs(args[0], "Restarted", func(job tools.JobState) error {
+			return tools.RestartJob(job, restartTimeout)
+		})
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(restartCmd)
+
+	restartCmd.Flags().DurationVar(&restartTimeout, "timeout", 10*time.Second, "How long to wait for the job to take the request")
+}
@@ -8,10 +8,14 @@ import (
 	"log"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strconv"
+	"syscall"
+	"time"
 
 	tools "github.com/mparvin/run4ever/tools"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
 var (
@@ -34,6 +38,54 @@ var (
 	exitOnSuccess     bool
 	persist           bool
 	restore           bool
+	backoffMode       string
+	backoffMax        int
+	backoffMultiplier float64
+	backoffJitter     string
+	backoffReset      int
+	schedule          string
+	timezone          string
+	missedRuns        string
+	rate              bool
+	overlap           string
+	maxConcurrent     int
+	successCodes      []int
+	fatalCodes        []int
+	timeoutSignal     string
+	killAfter         int
+	forwardSignals    []string
+	stopTimeout       int
+	hupRestart        bool
+	initMode          bool
+	maxFailures       int
+	failureWindow     time.Duration
+	resetOnSuccess    bool
+	breakerFailures   int
+	cooldown          time.Duration
+	probeCmd          string
+	logDir            string
+	logMaxSize        int
+	logMaxAge         time.Duration
+	logKeep           int
+	logCompress       bool
+	notifyOutputLines int
+	failOnOutput      []string
+	succeedOnOutput   []string
+	historyDir        string
+	historyMaxRuns    int
+	historyMaxAge     time.Duration
+	metricsAddr       string
+	healthAddr        string
+	readyMaxAge       time.Duration
+	logFormat         string
+	logFile           string
+	prefixOutput      bool
+	mergeOutput       bool
+	staleMaxAge       time.Duration
+	archiveStale      bool
+	hideStale         bool
+	jobName           string
+	jobTags           []string
 	currentJobID      string
 )
 
@@ -52,13 +104,25 @@ You can also enable verbose mode by using the -v flag. This will cause run4ever
 
 Notification methods supported: desktop, telegram, slack, email.`,
 	PersistentPreRun: func(cmd *cobra.Command, args []string) {
-		if len(args) > 0 {
+		// Only the root command runs a job, subcommands take job IDs as arguments.
+		// With -g and -D the job runs in the process started in the background.
+		background, _ := cmd.Flags().GetBool("background")
+		daemon, _ := cmd.Flags().GetBool("daemon")
+		if !cmd.HasParent() && len(args) > 0 && !background && !daemon {
 			jobID, err := tools.GenerateJobID()
 			if err != nil {
 				log.Fatalf("Failed to generate job ID: %v", err)
 			}
 			currentJobID = jobID
-			tools.LogWithJobID(args[0], args[1:], os.Getpid(), jobID, "")
+			if staleMaxAge > 0 {
+				if _, err := tools.PruneStaleJobs(tools.PruneOptions{OlderThan: staleMaxAge, Archive: archiveStale}); err != nil {
+					fmt.Fprintf(os.Stderr, "Warning: failed to prune stale jobs: %v\n", err)
+				}
+			}
+			tools.WatchControlRequests(jobID)
+			if err := tools.RegisterJob(args[0], args[1:], os.Getpid(), jobID, jobName, jobTags); err != nil {
+				log.Fatal(err)
+			}
 		}
 	},
 	PersistentPostRun: func(cmd *cobra.Command, args []string) {
@@ -79,16 +143,40 @@ Notification methods supported: desktop, telegram, slack, email.`,
 		return nil
 	},
 	DisableFlagParsing: false,
-	Run:                func(cmd *cobra.Command, args []string) {},
+	// Commands that are not subcommands are run as the job
+	Args: cobra.ArbitraryArgs,
+	Run:  func(cmd *cobra.Command, args []string) {},
 }
 
 func Execute() {
+	// A subcommand only runs when it is the first argument, so that a command
+	// named like one, as in "run4ever -d 5 kill -0 1234", is still supervised
+	if !startsWithSubcommand(os.Args[1:]) {
+		rootCmd.ResetCommands()
+	}
 	err := rootCmd.Execute()
 	if err != nil {
 		log.Fatal(err)
 	}
 }
 
+// startsWithSubcommand reports whether args begin with the name of a subcommand
+func startsWithSubcommand(args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+	switch args[0] {
+	case "help", cobra.ShellCompRequestCmd, cobra.ShellCompNoDescRequestCmd:
+		return true
+	}
+	for _, c := range rootCmd.Commands() {
+		if c.Name() == args[0] || c.HasAlias(args[0]) {
+			return true
+		}
+	}
+	return false
+}
+
 // runInBackground starts the process in the background using nohup
 func runInBackground() error {
 	// Remove the -g flag from arguments for the background process
@@ -200,8 +288,14 @@ PowerShell:
 	rootCmd.Flags().SetInterspersed(false)
 	rootCmd.Flags().BoolP("ps", "", false, "Show running jobs continuously (like top)")
 	rootCmd.Flags().BoolP("list", "l", false, "List all running jobs once and exit")
+	rootCmd.Flags().StringVar(&jobName, "name", "", "Name of the job, used instead of the job ID by logs, history, stop, restart and kill")
+	rootCmd.Flags().StringSliceVar(&jobTags, "tag", nil, "Tag the job so that stop, restart and kill can address it with others (repeatable)")
+	rootCmd.Flags().BoolVar(&hideStale, "hide-stale", false, "Leave stale jobs out of --ps and --list")
+	rootCmd.Flags().DurationVar(&staleMaxAge, "stale-max-age", 24*time.Hour, "Remove stale jobs without activity for this long from the state file when a job starts, 0 to keep them")
+	rootCmd.Flags().BoolVar(&archiveStale, "archive-stale", false, "Archive stale jobs removed at startup to ~/.run4ever/state-archive.jsonl")
 	rootCmd.Flags().StringVar(&notifyOn, "notify-on", "", "Notify on: failure, success, always")
 	rootCmd.Flags().StringVar(&notifyMethod, "notify-method", "desktop", "Notification method: desktop, telegram, slack, email")
+	rootCmd.Flags().IntVar(&notifyOutputLines, "notify-output-lines", 20, "Number of output lines included in failure notifications, 0 to disable")
 	rootCmd.Flags().StringVar(&telegramToken, "telegram-token", "", "Telegram bot token (required for Telegram notifications)")
 	rootCmd.Flags().StringVar(&telegramChatID, "telegram-chat-id", "", "Telegram chat ID (required for Telegram notifications)")
 	rootCmd.Flags().StringVar(&telegramCustomAPI, "telegram-custom-api", "", "Telegram custom API URL (optional)")
@@ -213,14 +307,66 @@ PowerShell:
 	rootCmd.Flags().StringVar(&emailSMTPHost, "email-smtp", "", "SMTP server hostname (required for email notifications)")
 	rootCmd.Flags().IntVar(&emailSMTPPort, "email-port", 587, "SMTP server port (default is 587)")
 	rootCmd.Flags().IntVarP(&maxRetries, "max-retries", "m", -1, "Maximum number of retries before giving up, -1 for infinite retries (default is -1)")
+	rootCmd.Flags().IntVar(&maxFailures, "max-failures", 0, "Open the circuit breaker after this many failures within --failure-window: stop the job, or pause it for --cooldown and probe before resuming. 0 to disable")
+	rootCmd.Flags().DurationVar(&failureWindow, "failure-window", 0, "Sliding window for --max-failures, e.g. 10m (default counts all failures)")
+	rootCmd.Flags().BoolVar(&resetOnSuccess, "reset-on-success", false, "Reset the --max-failures count after a successful run")
+	rootCmd.Flags().IntVar(&breakerFailures, "breaker-failures", 0, "Open the circuit breaker after this many consecutive failures, 0 to disable")
+	rootCmd.Flags().DurationVar(&cooldown, "cooldown", 0, "Wait this long after the breaker opens, then probe before resuming (default stops the job)")
+	rootCmd.Flags().StringVar(&probeCmd, "probe-cmd", "", "Shell command used to probe an open breaker (default runs the command itself)")
 	rootCmd.Flags().StringVarP(&timeout, "timeout", "t", "", "Timeout for command execution in seconds (default is no timeout)")
+	rootCmd.Flags().StringVar(&timeoutSignal, "timeout-signal", "TERM", "Signal sent to the command when the timeout expires")
+	rootCmd.Flags().IntVar(&killAfter, "kill-after", 10, "Seconds to wait after the timeout signal before sending SIGKILL, 0 to wait indefinitely")
+	rootCmd.Flags().StringSliceVar(&forwardSignals, "forward-signals", []string{"TERM", "INT", "HUP", "USR1", "USR2"}, "Signals forwarded to the running command")
+	rootCmd.Flags().IntVar(&stopTimeout, "stop-timeout", 10, "Seconds to wait for the command to exit after forwarding SIGINT/SIGTERM before killing it")
+	rootCmd.Flags().BoolVar(&hupRestart, "hup-restart", false, "Restart the command on SIGHUP instead of forwarding it")
+	rootCmd.Flags().BoolVar(&initMode, "init", false, "Act as an init process: reap orphaned processes and exit with the command's status (enabled automatically as PID 1)")
+	rootCmd.Flags().StringVar(&logDir, "log-dir", "", "Store the output of each run per job in this directory, e.g. ~/.run4ever/logs (default is no output log)")
+	rootCmd.Flags().IntVar(&logMaxSize, "log-max-size", 10, "Rotate the output log once it reaches this size in megabytes, 0 to disable")
+	rootCmd.Flags().DurationVar(&logMaxAge, "log-max-age", 0, "Rotate the output log once it is older than this, e.g. 24h (default no age limit)")
+	rootCmd.Flags().IntVar(&logKeep, "log-keep", 5, "Number of rotated output logs to keep per job")
+	rootCmd.Flags().BoolVar(&logCompress, "log-compress", false, "Compress rotated output logs with gzip")
+	rootCmd.Flags().BoolVar(&prefixOutput, "prefix-output", false, "Prefix each output line of the command with the time, run number and stream")
+	rootCmd.Flags().BoolVar(&mergeOutput, "merge-output", false, "Write the command's stderr to stdout instead of stderr")
+	rootCmd.Flags().StringVar(&historyDir, "history-dir", tools.GetHistoryDir(), "Directory where a record of each run is stored per job, empty to disable")
+	rootCmd.Flags().IntVar(&historyMaxRuns, "history-max-runs", 1000, "Number of run records kept per job, 0 for no limit")
+	rootCmd.Flags().DurationVar(&historyMaxAge, "history-max-age", 30*24*time.Hour, "Drop run records older than this, 0 for no limit")
+	rootCmd.Flags().StringVar(&metricsAddr, "metrics-addr", "", "Serve Prometheus metrics at /metrics on this address, e.g. :9101")
+	rootCmd.Flags().StringVar(&healthAddr, "health-addr", "", "Serve /healthz and /readyz on this address, e.g. :8080")
+	rootCmd.Flags().DurationVar(&readyMaxAge, "ready-max-age", 0, "Report not ready once the last successful run is older than this (default no age limit)")
+	rootCmd.Flags().StringVar(&logFormat, "log-format", "", "Write run4ever's own events to stderr, or --log-file, in this format: text, json (default is text with --log-file, otherwise none)")
+	rootCmd.Flags().StringVar(&logFile, "log-file", "", "Append run4ever's own events to this file (default is stderr with --log-format, otherwise none)")
 	rootCmd.Flags().BoolP("background", "g", false, "Run command in background (daemon mode)")
 	rootCmd.Flags().BoolP("daemon", "D", false, "Run command as a daemon (detached from terminal)")
-	rootCmd.Flags().BoolVar(&exitOnSuccess, "exit-on-success", false, "Exit when command succeeds (exit code 0)")
+	rootCmd.Flags().BoolVar(&exitOnSuccess, "exit-on-success", false, "Exit when command succeeds (exit code 0 or one of --success-codes)")
+	rootCmd.Flags().IntSliceVar(&successCodes, "success-codes", []int{0}, "Comma separated exit codes treated as success")
+	rootCmd.Flags().StringArrayVar(&failOnOutput, "fail-on-output", nil, "Treat a run as failed when a stdout/stderr line matches this regular expression (repeatable)")
+	rootCmd.Flags().StringArrayVar(&succeedOnOutput, "succeed-on-output", nil, "Treat a run as successful when a stdout/stderr line matches this regular expression (repeatable)")
+	rootCmd.Flags().IntSliceVar(&fatalCodes, "fatal-codes", nil, "Comma separated exit codes that stop retrying immediately")
 	rootCmd.Flags().BoolVar(&persist, "persist", false, "Save job definition for restore on restart")
 	rootCmd.Flags().BoolVar(&restore, "restore", false, "Restore and run all saved jobs")
+	rootCmd.Flags().StringVar(&backoffMode, "backoff", "fixed", "Delay growth on consecutive failures: fixed, linear, exponential")
+	rootCmd.Flags().IntVar(&backoffMax, "backoff-max", 0, "Maximum delay in seconds when backing off, 0 for no cap")
+	rootCmd.Flags().Float64Var(&backoffMultiplier, "backoff-multiplier", 2, "Multiplier applied per failure in exponential backoff")
+	rootCmd.Flags().StringVar(&backoffJitter, "backoff-jitter", "none", "Jitter applied to the delay: none, full, equal")
+	rootCmd.Flags().IntVar(&backoffReset, "backoff-reset", 1, "Consecutive successes needed to reset the delay to its base value")
+	rootCmd.Flags().StringVar(&schedule, "schedule", "", "Cron expression (5 or 6 fields) or @every/@hourly/@daily shortcut, replaces the delay")
+	rootCmd.Flags().StringVar(&timezone, "tz", "", "Time zone used to evaluate the schedule (default is local time)")
+	rootCmd.Flags().BoolVar(&rate, "rate", false, "Measure the delay from the start of one run to the start of the next")
+	rootCmd.Flags().StringVar(&overlap, "overlap", "skip", "With --rate, what to do when a run outlasts the delay: skip, queue, concurrent")
+	rootCmd.Flags().IntVar(&maxConcurrent, "max-concurrent", 1, "Maximum instances running at once with --overlap concurrent")
+	rootCmd.Flags().StringVar(&missedRuns, "missed-runs", "skip", "What to do with scheduled runs missed while the command was running: skip, run-once, catch-up")
 
 	rootCmd.PreRun = func(cmd *cobra.Command, args []string) {
+		if logFile != "" {
+			// Saved jobs are restored from another working directory
+			if abs, err := filepath.Abs(logFile); err == nil {
+				logFile = abs
+			}
+		}
+		if err := tools.OpenEventLog(tools.EventLogConfig{Format: logFormat, File: logFile}); err != nil {
+			log.Fatal(err)
+		}
+
 		// Handle restore flag
 		restoreFlag, _ := cmd.Flags().GetBool("restore")
 		if restoreFlag {
@@ -263,7 +409,7 @@ PowerShell:
 		// Load config with priority: CLI flags > env vars > config files
 		config, err := tools.LoadConfig(verbose)
 		if err != nil && verbose {
-			fmt.Printf("Warning: failed to load config: %v\n", err)
+			fmt.Fprintf(os.Stderr, "Warning: failed to load config: %v\n", err)
 		}
 
 		// Apply config values, but CLI flags take precedence
@@ -296,28 +442,130 @@ PowerShell:
 			}
 		}
 
+		sig, err := tools.ParseSignal(timeoutSignal)
+		if err != nil {
+			log.Fatalf("Invalid timeout signal: %v", err)
+		}
+		if killAfter < 0 {
+			log.Fatal("Invalid kill-after value provided")
+		}
+		timeoutPolicy := tools.TimeoutPolicy{
+			Signal:    sig,
+			KillAfter: time.Duration(killAfter) * time.Second,
+		}
+
+		var forward []syscall.Signal
+		for _, name := range forwardSignals {
+			sig, err := tools.ParseSignal(name)
+			if err != nil {
+				log.Fatalf("Invalid forwarded signal: %v", err)
+			}
+			forward = append(forward, sig)
+		}
+		signals := tools.SignalConfig{
+			Forward:     forward,
+			StopTimeout: time.Duration(stopTimeout) * time.Second,
+			HUPRestart:  hupRestart,
+		}
+
+		backoff := tools.Backoff{
+			Mode:       backoffMode,
+			Max:        backoffMax,
+			Multiplier: backoffMultiplier,
+			Jitter:     backoffJitter,
+			ResetAfter: backoffReset,
+		}
+		if err := backoff.Validate(); err != nil {
+			log.Fatal(err)
+		}
+
+		exitCodes := tools.ExitCodes{
+			Success: successCodes,
+			Fatal:   fatalCodes,
+		}
+		if err := exitCodes.Validate(); err != nil {
+			log.Fatal(err)
+		}
+
+		var outputMatchers tools.OutputMatchers
+		if outputMatchers.Fail, err = tools.CompilePatterns("--fail-on-output", failOnOutput); err != nil {
+			log.Fatal(err)
+		}
+		if outputMatchers.Succeed, err = tools.CompilePatterns("--succeed-on-output", succeedOnOutput); err != nil {
+			log.Fatal(err)
+		}
+
+		var jobSchedule tools.Schedule
+		if schedule != "" {
+			loc := time.Local
+			if timezone != "" {
+				loc, err = time.LoadLocation(timezone)
+				if err != nil {
+					log.Fatalf("Invalid time zone: %v", err)
+				}
+			}
+			jobSchedule, err = tools.ParseSchedule(schedule, loc)
+			if err != nil {
+				log.Fatalf("Invalid schedule: %v", err)
+			}
+			if err := tools.ValidateMissedRuns(missedRuns); err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		if notifyOutputLines < 0 {
+			log.Fatal("--notify-output-lines must not be negative")
+		}
+
+		if logMaxSize < 0 || logKeep < 0 || logMaxAge < 0 {
+			log.Fatal("--log-max-size, --log-max-age and --log-keep must not be negative")
+		}
+
+		if historyMaxRuns < 0 || historyMaxAge < 0 {
+			log.Fatal("--history-max-runs and --history-max-age must not be negative")
+		}
+
+		if readyMaxAge < 0 {
+			log.Fatal("--ready-max-age must not be negative")
+		}
+
+		if rate {
+			if err := tools.ValidateOverlap(overlap); err != nil {
+				log.Fatal(err)
+			}
+			if delayInt <= 0 {
+				log.Fatal("--rate requires a positive delay")
+			}
+		}
+
 		if verbose {
-			fmt.Println("run4ever called")
-			fmt.Println("delay is", delayInt)
+			fmt.Fprintln(os.Stderr, "run4ever called")
+			fmt.Fprintln(os.Stderr, "delay is", delayInt)
 			if timeoutInt > 0 {
-				fmt.Println("timeout is", timeoutInt, "seconds")
+				fmt.Fprintln(os.Stderr, "timeout is", timeoutInt, "seconds")
 			}
 		}
 
 		psProvided, _ := cmd.Flags().GetBool("ps")
 		listProvided, _ := cmd.Flags().GetBool("list")
 		if psProvided {
-			tools.Ps()
+			tools.Ps(hideStale)
 			return
 		}
 		if listProvided {
-			tools.ListJobs()
+			tools.ListJobs(hideStale)
 			return
 		}
 
 		// Handle persist flag
 		persistFlag, _ := cmd.Flags().GetBool("persist")
 		if persistFlag {
+			// Only settings given on the command line are restored, the others
+			// get the defaults of the run4ever version that restores the job
+			var setFlags []string
+			cmd.Flags().Visit(func(f *pflag.Flag) {
+				setFlags = append(setFlags, f.Name)
+			})
 			jobDef := tools.JobDefinition{
 				Command:           args,
 				Delay:             delayInt,
@@ -329,12 +577,74 @@ PowerShell:
 				TelegramChatID:    telegramChatID,
 				TelegramCustomAPI: telegramCustomAPI,
 				ExitOnSuccess:     exitOnSuccess,
+				Flags:             setFlags,
+				Name:              jobName,
+				Tags:              jobTags,
+				Backoff:           backoff,
+				Schedule:          schedule,
+				Timezone:          timezone,
+				MissedRuns:        missedRuns,
+				Rate:              rate,
+				Overlap:           overlap,
+				MaxConcurrent:     maxConcurrent,
+				SuccessCodes:      successCodes,
+				FatalCodes:        fatalCodes,
+				TimeoutSignal:     timeoutSignal,
+				KillAfter:         killAfter,
+				ForwardSignals:    forwardSignals,
+				StopTimeout:       stopTimeout,
+				HUPRestart:        hupRestart,
+				Init:              initMode,
+				MaxFailures:       maxFailures,
+				FailureWindow:     failureWindow.String(),
+				ResetOnSuccess:    resetOnSuccess,
+				BreakerFailures:   breakerFailures,
+				Cooldown:          cooldown.String(),
+				ProbeCommand:      probeCmd,
+				LogDir:            logDir,
+				LogMaxSize:        logMaxSize,
+				LogMaxAge:         logMaxAge.String(),
+				LogKeep:           logKeep,
+				LogCompress:       logCompress,
+				NotifyOutputLines: notifyOutputLines,
+				FailOnOutput:      failOnOutput,
+				SucceedOnOutput:   succeedOnOutput,
+				HistoryDir:        historyDir,
+				HistoryMaxRuns:    historyMaxRuns,
+				HistoryMaxAge:     historyMaxAge.String(),
+				MetricsAddr:       metricsAddr,
+				HealthAddr:        healthAddr,
+				ReadyMaxAge:       readyMaxAge.String(),
+				LogFormat:         logFormat,
+				LogFile:           logFile,
+				PrefixOutput:      prefixOutput,
+				MergeOutput:       mergeOutput,
+				StaleMaxAge:       staleMaxAge.String(),
+				ArchiveStale:      archiveStale,
 			}
 			if err := tools.SaveJobDefinition(jobDef); err != nil {
 				log.Fatalf("Failed to save job definition: %v", err)
 			}
 			if verbose {
-				fmt.Println("Job definition saved")
+				fmt.Fprintln(os.Stderr, "Job definition saved")
+			}
+		}
+
+		if metricsAddr != "" {
+			if err := tools.ServeMetrics(metricsAddr); err != nil {
+				log.Fatalf("Failed to serve metrics: %v", err)
+			}
+			if verbose {
+				fmt.Fprintf(os.Stderr, "Serving metrics on %s/metrics\n", metricsAddr)
+			}
+		}
+
+		if healthAddr != "" {
+			if err := tools.ServeHealth(healthAddr, readyMaxAge); err != nil {
+				log.Fatalf("Failed to serve health endpoints: %v", err)
+			}
+			if verbose {
+				fmt.Fprintf(os.Stderr, "Serving health checks on %s/healthz and %s/readyz\n", healthAddr, healthAddr)
 			}
 		}
 
@@ -356,6 +666,46 @@ PowerShell:
 			emailPassword,
 			emailSMTPHost,
 			emailSMTPPort,
+			tools.RunOptions{
+				JobID:         currentJobID,
+				JobName:       jobName,
+				Backoff:       backoff,
+				Schedule:      jobSchedule,
+				MissedRuns:    missedRuns,
+				Rate:          rate,
+				Overlap:       overlap,
+				MaxConcurrent: maxConcurrent,
+				ExitCodes:     exitCodes,
+				TimeoutPolicy: timeoutPolicy,
+				Signals:       signals,
+				InitMode:      initMode || os.Getpid() == 1,
+				FailureBudget: tools.FailureBudget{
+					MaxFailures:    maxFailures,
+					Window:         failureWindow,
+					ResetOnSuccess: resetOnSuccess,
+				},
+				Breaker: tools.BreakerConfig{
+					Failures:     breakerFailures,
+					Cooldown:     cooldown,
+					ProbeCommand: probeCmd,
+				},
+				OutputLog: tools.OutputLogConfig{
+					Dir:      logDir,
+					MaxSize:  int64(logMaxSize) * 1024 * 1024,
+					MaxAge:   logMaxAge,
+					Keep:     logKeep,
+					Compress: logCompress,
+				},
+				NotifyOutputLines: notifyOutputLines,
+				OutputMatchers:    outputMatchers,
+				History: tools.HistoryConfig{
+					Dir:        historyDir,
+					MaxRecords: historyMaxRuns,
+					MaxAge:     historyMaxAge,
+				},
+				PrefixOutput: prefixOutput,
+				MergeOutput:  mergeOutput,
+			},
 		)
 	}
 }
@@ -0,0 +1,85 @@
+//go:build !windows
+
+package cmd
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	tools "github.com/mparvin/run4ever/tools"
+)
+
+// TestExecuteHelper runs run4ever with the arguments in RUN4EVER_TEST_ARGS when
+// started by runHelper, it does nothing otherwise
+func TestExecuteHelper(t *testing.T) {
+	if os.Getenv("RUN4EVER_TEST_ARGS") == "" {
+		t.Skip("only run as a helper process")
+	}
+	os.Args = append([]string{"run4ever"}, strings.Fields(os.Getenv("RUN4EVER_TEST_ARGS"))...)
+	tools.CreateDir(filepath.Join(os.Getenv("HOME"), ".run4ever"))
+	tools.InitStateFile(tools.GetStateFile())
+	Execute()
+	os.Exit(0)
+}
+
+// runHelper runs run4ever with args in a helper process and returns its output
+// and exit code
+func runHelper(t *testing.T, args ...string) (string, int) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], "-test.run=^TestExecuteHelper$")
+	cmd.Env = append(os.Environ(),
+		"RUN4EVER_TEST_ARGS="+strings.Join(args, " "),
+		"HOME="+t.TempDir(),
+	)
+	done := make(chan struct{})
+	timer := time.AfterFunc(10*time.Second, func() {
+		cmd.Process.Kill()
+		close(done)
+	})
+	out, _ := cmd.CombinedOutput()
+	if !timer.Stop() {
+		<-done
+		t.Fatalf("run4ever %s did not exit:\n%s", strings.Join(args, " "), out)
+	}
+	return string(out), cmd.ProcessState.ExitCode()
+}
+
+func TestSupervisesCommandNamedLikeSubcommand(t *testing.T) {
+	// kill is a subcommand of run4ever, but here it follows the flags
+	out, code := runHelper(t, "-d", "1", "--exit-on-success", "--history-dir=", "kill", "-0", strconv.Itoa(os.Getpid()))
+	if code != 0 {
+		t.Fatalf("Supervising kill exited with %d:\n%s", code, out)
+	}
+}
+
+func TestRunsSubcommandGivenFirst(t *testing.T) {
+	out, code := runHelper(t, "prune", "--dry-run")
+	if code != 0 || !strings.Contains(out, "No stale jobs found.") {
+		t.Fatalf("prune exited with %d:\n%s", code, out)
+	}
+}
+
+func TestStartsWithSubcommand(t *testing.T) {
+	tests := []struct {
+		args []string
+		want bool
+	}{
+		{[]string{"kill", "3f2a"}, true},
+		{[]string{"logs", "-f", "3f2a"}, true},
+		{[]string{"help"}, true},
+		{[]string{"-d", "5", "kill", "-0", "1234"}, false},
+		{[]string{"--", "stats"}, false},
+		{[]string{"echo", "kill"}, false},
+		{nil, false},
+	}
+	for _, tt := range tests {
+		if got := startsWithSubcommand(tt.args); got != tt.want {
+			t.Errorf("startsWithSubcommand(%q) = %v, want %v", tt.args, got, tt.want)
+		}
+	}
+}
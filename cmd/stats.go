@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"log"
+	"os"
+	"time"
+
+	tools "github.com/mparvin/run4ever/tools"
+	"github.com/spf13/cobra"
+)
+
+var (
+	statsJSON   bool
+	statsWindow time.Duration
+	statsDir    string
+)
+
+// statsCmd summarizes the recorded runs of jobs
+var statsCmd = &cobra.Command{
+	Use:   "stats [flags] [job-id|name]",
+	Short: "Show run statistics of jobs",
+	Long: `Show statistics computed from the run history: number of runs, success rate,
+p50/p95/p99 run duration, longest success and failure streaks, mean time between
+failures (MTBF) and the time and reason of the last failure.
+
+Without a job, statistics are shown for every job with a recorded history.
+The job can be given by name, by full job ID or by any unique prefix of the job ID shown by --ps.`,
+	Example: `run4ever stats
+run4ever stats --window 24h 3f2a
+run4ever stats --json 3f2a`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		query := ""
+		if len(args) > 0 {
+			query = args[0]
+		}
+		stats, err := tools.ReadStats(statsDir, query, statsWindow)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := tools.PrintStats(os.Stdout, stats, statsJSON); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(statsCmd)
+
+	statsCmd.Flags().BoolVar(&statsJSON, "json", false, "Print the statistics as JSON")
+	statsCmd.Flags().DurationVarP(&statsWindow, "window", "w", 0, "Only include runs started within this window, e.g. 24h (default all recorded runs)")
+	statsCmd.Flags().StringVar(&statsDir, "history-dir", tools.GetHistoryDir(), "Directory where the run history is stored")
+}
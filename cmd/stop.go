@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"time"
+
+	tools "github.com/mparvin/run4ever/tools"
+	"github.com/spf13/cobra"
+)
+
+var stopTimeoutFlag time.Duration
+
+// stopCmd stops a running job gracefully
+var stopCmd = &cobra.Command{
+	Use:   "stop [flags] <job-id|name|tag>",
+	Short: "Stop a running job",
+	Long: `Send SIGTERM to the run4ever process of a job and wait for it to exit. The signal is
+forwarded to the running command, which is killed once --stop-timeout of the job expires.
+
+The job can be given by name, by full job ID or by any unique prefix of the job ID shown by --ps.
+Given a tag, every running job with that tag is stopped.`,
+	Example: `run4ever stop 3f2a
+run4ever stop --timeout 1m backup`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		controlJobs(args[0], "Stopped", func(job tools.JobState) error {
+			return tools.StopJob(job, stopTimeoutFlag)
+		})
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(stopCmd)
+
+	stopCmd.Flags().DurationVar(&stopTimeoutFlag, "timeout", 30*time.Second, "How long to wait for the job to exit")
+}
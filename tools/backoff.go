@@ -0,0 +1,126 @@
+package tools
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// Backoff describes how the delay between runs grows while a command keeps failing
+type Backoff struct {
+	Mode       string  `json:"mode,omitempty"`       // fixed, linear, exponential
+	Max        int     `json:"max,omitempty"`        // upper bound in seconds, 0 for no cap
+	Multiplier float64 `json:"multiplier,omitempty"` // growth factor for exponential mode
+	Jitter     string  `json:"jitter,omitempty"`     // none, full, equal
+	ResetAfter int     `json:"reset_after,omitempty"`
+}
+
+// Validate checks that the backoff settings are usable
+func (b Backoff) Validate() error {
+	switch b.Mode {
+	case "", "fixed", "linear", "exponential":
+	default:
+		return fmt.Errorf("invalid backoff mode %q, expected fixed, linear or exponential", b.Mode)
+	}
+	switch b.Jitter {
+	case "", "none", "full", "equal":
+	default:
+		return fmt.Errorf("invalid backoff jitter %q, expected none, full or equal", b.Jitter)
+	}
+	if b.Max < 0 {
+		return fmt.Errorf("backoff max must not be negative")
+	}
+	if b.Mode == "exponential" && b.Multiplier != 0 && b.Multiplier < 1 {
+		return fmt.Errorf("backoff multiplier must be at least 1")
+	}
+	if b.ResetAfter < 0 {
+		return fmt.Errorf("backoff reset must not be negative")
+	}
+	return nil
+}
+
+// backoffState tracks consecutive failures and successes to compute the next delay
+type backoffState struct {
+	policy    Backoff
+	base      time.Duration
+	failures  int
+	successes int
+}
+
+func newBackoffState(policy Backoff, base time.Duration) *backoffState {
+	return &backoffState{policy: policy, base: base}
+}
+
+// record updates the streak counters after a run
+func (s *backoffState) record(success bool) {
+	if !success {
+		s.failures++
+		s.successes = 0
+		return
+	}
+
+	s.successes++
+	resetAfter := s.policy.ResetAfter
+	if resetAfter <= 0 {
+		resetAfter = 1
+	}
+	if s.successes >= resetAfter {
+		s.failures = 0
+	}
+}
+
+// next returns the delay to wait before the next run
+func (s *backoffState) next() time.Duration {
+	return applyJitter(s.policy.Jitter, s.raw())
+}
+
+// raw returns the delay before jitter is applied
+func (s *backoffState) raw() time.Duration {
+	d := s.base
+	if s.failures > 1 {
+		switch s.policy.Mode {
+		case "linear":
+			d = s.base * time.Duration(s.failures)
+		case "exponential":
+			multiplier := s.policy.Multiplier
+			if multiplier == 0 {
+				multiplier = 2
+			}
+			f := float64(s.base) * math.Pow(multiplier, float64(s.failures-1))
+			if f > math.MaxInt64 {
+				d = time.Duration(math.MaxInt64)
+			} else {
+				d = time.Duration(f)
+			}
+		}
+		// Guard against overflow from large failure counts
+		if d < s.base {
+			d = time.Duration(math.MaxInt64)
+		}
+	}
+
+	if s.policy.Max > 0 {
+		max := time.Duration(s.policy.Max) * time.Second
+		if d > max {
+			d = max
+		}
+	}
+	return d
+}
+
+// applyJitter randomizes a delay according to the jitter strategy
+func applyJitter(jitter string, d time.Duration) time.Duration {
+	if d <= 0 {
+		return d
+	}
+	switch jitter {
+	case "full":
+		return time.Duration(rand.Int63n(int64(d) + 1))
+	case "equal":
+		half := d / 2
+		return half + time.Duration(rand.Int63n(int64(d-half)+1))
+	default:
+		return d
+	}
+}
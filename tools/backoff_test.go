@@ -0,0 +1,90 @@
+package tools
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoffValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		backoff Backoff
+		wantErr bool
+	}{
+		{"defaults", Backoff{}, false},
+		{"exponential full jitter", Backoff{Mode: "exponential", Multiplier: 2, Jitter: "full"}, false},
+		{"invalid mode", Backoff{Mode: "random"}, true},
+		{"invalid jitter", Backoff{Jitter: "some"}, true},
+		{"negative max", Backoff{Max: -1}, true},
+		{"multiplier below one", Backoff{Mode: "exponential", Multiplier: 0.5}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.backoff.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestBackoffDelay(t *testing.T) {
+	base := 10 * time.Second
+	tests := []struct {
+		name     string
+		policy   Backoff
+		failures int
+		expected time.Duration
+	}{
+		{"fixed ignores failures", Backoff{Mode: "fixed"}, 5, 10 * time.Second},
+		{"linear first failure", Backoff{Mode: "linear"}, 1, 10 * time.Second},
+		{"linear third failure", Backoff{Mode: "linear"}, 3, 30 * time.Second},
+		{"exponential default multiplier", Backoff{Mode: "exponential"}, 3, 40 * time.Second},
+		{"exponential custom multiplier", Backoff{Mode: "exponential", Multiplier: 3}, 3, 90 * time.Second},
+		{"exponential capped", Backoff{Mode: "exponential", Max: 60}, 10, 60 * time.Second},
+		{"exponential overflow capped", Backoff{Mode: "exponential", Max: 60}, 500, 60 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newBackoffState(tt.policy, base)
+			for i := 0; i < tt.failures; i++ {
+				s.record(false)
+			}
+			if got := s.next(); got != tt.expected {
+				t.Errorf("next() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestBackoffReset(t *testing.T) {
+	s := newBackoffState(Backoff{Mode: "linear", ResetAfter: 2}, time.Second)
+	s.record(false)
+	s.record(false)
+	s.record(false)
+	s.record(true)
+	if got := s.next(); got != 3*time.Second {
+		t.Errorf("delay should not reset after one success, got %v", got)
+	}
+	s.record(true)
+	if got := s.next(); got != time.Second {
+		t.Errorf("delay should reset after two successes, got %v", got)
+	}
+}
+
+func TestBackoffJitter(t *testing.T) {
+	d := 10 * time.Second
+	for i := 0; i < 100; i++ {
+		if got := applyJitter("full", d); got < 0 || got > d {
+			t.Fatalf("full jitter out of range: %v", got)
+		}
+		if got := applyJitter("equal", d); got < d/2 || got > d {
+			t.Fatalf("equal jitter out of range: %v", got)
+		}
+	}
+	if got := applyJitter("none", d); got != d {
+		t.Errorf("no jitter should keep delay, got %v", got)
+	}
+}
@@ -0,0 +1,91 @@
+package tools
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// BreakerConfig controls the circuit breaker that pauses a failing job
+type BreakerConfig struct {
+	Failures     int           // consecutive failures that open the breaker, 0 to disable
+	Cooldown     time.Duration // wait before probing an open breaker, 0 stops the job instead
+	ProbeCommand string        // shell command used as probe, the job's command when empty
+}
+
+// openBreaker pauses the job after too many failures. Without a cooldown the job
+// stops and its state entry keeps the OPEN status so that job lists show why.
+// Otherwise a single probe runs after each cooldown, and normal runs resume once
+// a probe succeeds.
+func (r *runner) openBreaker(reason string) {
+	cooldown := r.opts.Breaker.Cooldown
+	if cooldown <= 0 {
+		r.breakerTransition("OPEN", fmt.Sprintf("reached %s, stopping", reason))
+		r.exit(1)
+	}
+
+	r.breakerTransition("OPEN", fmt.Sprintf("reached %s, pausing for %s", reason, cooldown))
+	for {
+		sleepOrWake(cooldown)
+		r.breakerTransition("HALF-OPEN", "cooldown elapsed, running probe")
+		if r.probe() {
+			break
+		}
+		r.breakerTransition("OPEN", fmt.Sprintf("probe failed, pausing for %s", cooldown))
+	}
+
+	r.consecutiveFailures = 0
+	r.failures.reset()
+	r.breakerTransition("", "probe succeeded, resuming")
+}
+
+// breakerTransition records a breaker state change and notifies about it. Closing
+// the breaker is notified like a success, opening it and probing like a failure.
+func (r *runner) breakerTransition(state string, detail string) {
+	metrics.setBreaker(state)
+	if r.opts.JobID != "" {
+		reportStateError(UpdateBreaker(r.opts.JobID, state))
+	}
+
+	name := state
+	if name == "" {
+		name = "CLOSED"
+	}
+	if r.verbose {
+		fmt.Fprintf(os.Stderr, "Circuit breaker %s: %s\n", name, detail)
+	}
+	events.warn("breaker", "state", strings.ToLower(name), "detail", detail)
+	if shouldNotify(r.notifyOn, state == "") {
+		title := "run4ever: Circuit " + name
+		maskedArgs := MaskPassword(r.args)
+		message := fmt.Sprintf("Command %s %s %s", r.args[0], maskedArgs, detail)
+		if r.verbose {
+			fmt.Fprintf(os.Stderr, "Sending notification\nTitle: %s\nMessage: %s\n", title, message)
+		}
+		doNotify(r.notifyOn, r.notifyMethod, r.verbose, title, message)
+	}
+}
+
+// probe runs the probe command, or the job's command itself, once
+func (r *runner) probe() bool {
+	var res runResult
+	var success bool
+	if r.opts.Breaker.ProbeCommand == "" {
+		res = r.execute()
+		success = res.succeeded(r.opts.ExitCodes)
+		r.recordRun(res)
+	} else {
+		cmd := exec.Command("sh", "-c", r.opts.Breaker.ProbeCommand)
+		cmd.Stdout, cmd.Stderr = r.terminal()
+		res = r.wait(cmd)
+		success = res.exitStatus == 0
+	}
+
+	if _, ok := stopRequested(); ok {
+		exitOnSignal(res.exitStatus)
+	}
+	takeRestart()
+	return success
+}
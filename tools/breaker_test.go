@@ -0,0 +1,145 @@
+package tools
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOpenBreakerProbesUntilSuccess(t *testing.T) {
+	setupTestLogFile(t)
+	os.MkdirAll(filepath.Dir(GetStateFile()), 0755)
+	InitStateFile(GetStateFile())
+
+	jobID := "test-job-id-12345"
+	LogWithJobID("false", nil, os.Getpid(), jobID, "")
+
+	probeFile := filepath.Join(t.TempDir(), "healthy")
+	r := &runner{
+		args: []string{"false"},
+		opts: RunOptions{
+			JobID:   jobID,
+			Breaker: BreakerConfig{Failures: 2, Cooldown: 100 * time.Millisecond, ProbeCommand: "test -e " + probeFile},
+		},
+		backoff:  newBackoffState(Backoff{}, 0),
+		failures: newFailureWindow(FailureBudget{}),
+	}
+
+	go func() {
+		time.Sleep(300 * time.Millisecond)
+		os.WriteFile(probeFile, nil, 0644)
+	}()
+
+	done := make(chan struct{})
+	go func() {
+		r.handleResult(runResult{exitStatus: 1})
+		r.handleResult(runResult{exitStatus: 1})
+		close(done)
+	}()
+
+	// The breaker should be visible as open while the probe keeps failing
+	time.Sleep(150 * time.Millisecond)
+	jobs, _ := readStateFile(GetStateFile())
+	if len(jobs) != 1 || jobs[0].Breaker == "" {
+		t.Errorf("Expected open breaker in state file, got %+v", jobs)
+	}
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Breaker did not close after the probe succeeded")
+	}
+
+	jobs, _ = readStateFile(GetStateFile())
+	if len(jobs) != 1 || jobs[0].Status() != "RUNNING" {
+		t.Errorf("Expected closed breaker in state file, got %+v", jobs)
+	}
+	if r.consecutiveFailures != 0 {
+		t.Errorf("Consecutive failures should reset after closing, got %d", r.consecutiveFailures)
+	}
+}
+
+func TestFailureBudgetWithCooldown(t *testing.T) {
+	setupTestLogFile(t)
+	var buf bytes.Buffer
+	events = &eventLogger{w: &buf, format: "json"}
+	defer func() { events = &eventLogger{} }()
+
+	r := &runner{
+		args: []string{"false"},
+		opts: RunOptions{
+			FailureBudget: FailureBudget{MaxFailures: 2},
+			Breaker:       BreakerConfig{Cooldown: 50 * time.Millisecond, ProbeCommand: "true"},
+		},
+		backoff:  newBackoffState(Backoff{}, 0),
+		failures: newFailureWindow(FailureBudget{MaxFailures: 2}),
+	}
+
+	// Exhausting the budget pauses the job and returns once the probe succeeds,
+	// where it would exit without a cooldown
+	done := make(chan struct{})
+	go func() {
+		r.handleResult(runResult{exitStatus: 1})
+		r.handleResult(runResult{exitStatus: 1})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Job did not resume after the probe succeeded")
+	}
+
+	var states []string
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if strings.Contains(line, `"event":"breaker"`) {
+			var event map[string]interface{}
+			json.Unmarshal([]byte(line), &event)
+			states = append(states, event["state"].(string))
+		}
+	}
+	if strings.Join(states, ",") != "open,half-open,closed" {
+		t.Errorf("Breaker went through %v, want open, half-open, closed", states)
+	}
+
+	// The budget starts over, so a single failure does not open the breaker again
+	buf.Reset()
+	r.handleResult(runResult{exitStatus: 1})
+	if strings.Contains(buf.String(), `"event":"breaker"`) {
+		t.Errorf("Breaker opened again after one failure: %s", buf.String())
+	}
+}
+
+func TestBreakerTransitionNotifyOn(t *testing.T) {
+	setupTestLogFile(t)
+	tests := []struct {
+		notifyOn string
+		state    string
+		want     bool
+	}{
+		{"failure", "OPEN", true},
+		{"failure", "HALF-OPEN", true},
+		{"failure", "", false},
+		{"success", "OPEN", false},
+		{"success", "", true},
+		{"always", "HALF-OPEN", true},
+		{"", "OPEN", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.notifyOn+" "+tt.state, func(t *testing.T) {
+			var buf bytes.Buffer
+			events = &eventLogger{w: &buf, format: "json"}
+			defer func() { events = &eventLogger{} }()
+
+			// The unknown method keeps the test from sending anything
+			r := &runner{args: []string{"false"}, notifyOn: tt.notifyOn, notifyMethod: "test"}
+			r.breakerTransition(tt.state, "test")
+			if got := strings.Contains(buf.String(), `"event":"notification_`); got != tt.want {
+				t.Errorf("notified = %v, want %v, events:\n%s", got, tt.want, buf.String())
+			}
+		})
+	}
+}
@@ -26,7 +26,7 @@ func LoadConfig(verbose bool) (*Config, error) {
 	systemConfigPath := "/etc/run4ever/config.yaml"
 	if err := loadConfigFile(systemConfigPath, config, verbose); err != nil && !os.IsNotExist(err) {
 		if verbose {
-			fmt.Printf("Warning: failed to load system config: %v\n", err)
+			fmt.Fprintf(os.Stderr, "Warning: failed to load system config: %v\n", err)
 		}
 	}
 
@@ -36,7 +36,7 @@ func LoadConfig(verbose bool) (*Config, error) {
 		userConfigPath := filepath.Join(homeDir, ".config", "run4ever", "config.yaml")
 		if err := loadConfigFile(userConfigPath, config, verbose); err != nil && !os.IsNotExist(err) {
 			if verbose {
-				fmt.Printf("Warning: failed to load user config: %v\n", err)
+				fmt.Fprintf(os.Stderr, "Warning: failed to load user config: %v\n", err)
 			}
 		}
 	}
@@ -71,7 +71,7 @@ func loadConfigFile(path string, config *Config, verbose bool) error {
 	// Check file permissions
 	if err := checkConfigPermissions(path, verbose); err != nil {
 		if verbose {
-			fmt.Printf("Warning: config file %s has insecure permissions: %v\n", path, err)
+			fmt.Fprintf(os.Stderr, "Warning: config file %s has insecure permissions: %v\n", path, err)
 		}
 		// Continue loading despite permission warning
 	}
@@ -87,7 +87,7 @@ func loadConfigFile(path string, config *Config, verbose bool) error {
 	}
 
 	if verbose {
-		fmt.Printf("Loaded config from: %s\n", path)
+		fmt.Fprintf(os.Stderr, "Loaded config from: %s\n", path)
 	}
 
 	return nil
@@ -0,0 +1,237 @@
+package tools
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+)
+
+// Control requests left in the state entry of a job before its supervisor is
+// sent SIGHUP, so that it can tell them from a SIGHUP meant for the command
+const (
+	controlRestart = "restart"
+	controlKill    = "kill"
+)
+
+// FindRunningJobs returns the state entries of the running jobs matching query:
+// the job with that full ID or name, all jobs with that tag, or the job whose ID
+// starts with query
+func FindRunningJobs(query string) ([]JobState, error) {
+	return findRunningJobs(query, GetStateFile())
+}
+
+func findRunningJobs(query string, logFile string) ([]JobState, error) {
+	stateMutex.Lock()
+	jobs, err := readStateFile(logFile)
+	stateMutex.Unlock()
+
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if query == "" {
+		return nil, fmt.Errorf("no job ID given")
+	}
+
+	// A stale job may have left the name behind for a running one
+	var running, tagged []JobState
+	for _, job := range jobs {
+		if job.IsStale {
+			continue
+		}
+		if job.JobID == query || job.Name == query {
+			return []JobState{job}, nil
+		}
+		if containsString(job.Tags, query) {
+			tagged = append(tagged, job)
+		}
+		running = append(running, job)
+	}
+	if len(tagged) > 0 {
+		return tagged, nil
+	}
+
+	jobID, err := matchJobID(query, running)
+	if err != nil {
+		// Explain why a job that is only in the state file cannot be used
+		if staleID, staleErr := matchJobID(query, jobs); staleErr == nil {
+			return nil, fmt.Errorf("job %s is not running (STALE), remove it with run4ever prune", staleID)
+		}
+		return nil, err
+	}
+	for _, job := range running {
+		if job.JobID == jobID {
+			return []JobState{job}, nil
+		}
+	}
+	return nil, fmt.Errorf("no job matches %q", query)
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// StopJob sends SIGTERM to the supervisor of a job, which stops the command the
+// same way as --stop-timeout describes, and waits up to timeout for it to exit
+func StopJob(job JobState, timeout time.Duration) error {
+	if err := signalProcess(job.PID, syscall.SIGTERM); err != nil {
+		return fmt.Errorf("failed to stop job %s: %w", job.JobID, err)
+	}
+	if !waitForJobExit(job, timeout) {
+		return fmt.Errorf("job %s did not exit within %v, use run4ever kill to force it", job.JobID, timeout)
+	}
+	return nil
+}
+
+// RestartJob asks the supervisor of a job to stop the running command and start
+// a fresh run right away, keeping its retry count and backoff delay. It waits up
+// to timeout for the supervisor to take the request.
+func RestartJob(job JobState, timeout time.Duration) error {
+	return restartJobWithFile(job, timeout, GetStateFile())
+}
+
+func restartJobWithFile(job JobState, timeout time.Duration, logFile string) error {
+	if err := sendControlRequest(job, controlRestart, logFile); err != nil {
+		return fmt.Errorf("failed to restart job %s: %w", job.JobID, err)
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		current, err := findRunningJobs(job.JobID, logFile)
+		if err != nil || current[0].Request != controlRestart {
+			return nil
+		}
+		if !time.Now().Before(deadline) {
+			setControlRequest(job.JobID, "", logFile)
+			return fmt.Errorf("job %s did not take the restart request within %v", job.JobID, timeout)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// KillJob asks the supervisor of a job to kill its running command with SIGKILL
+// and exit at once. When it does not exit within timeout, or cannot be asked,
+// the supervisor and the process groups of its commands are killed, and its
+// state entry is removed once they are gone.
+func KillJob(job JobState, timeout time.Duration) error {
+	return killJobWithFile(job, timeout, GetStateFile())
+}
+
+func killJobWithFile(job JobState, timeout time.Duration, logFile string) error {
+	if err := sendControlRequest(job, controlKill, logFile); err == nil && waitForJobExit(job, timeout) {
+		return nil
+	}
+	if err := signalProcess(job.PID, syscall.SIGKILL); err != nil && isJobRunning(job) {
+		return fmt.Errorf("failed to kill job %s: %w", job.JobID, err)
+	}
+
+	// The commands run in their own process groups and outlive the supervisor
+	groups := job.ProcessGroups
+	if current, ok := jobEntry(job.JobID, logFile); ok {
+		groups = current.ProcessGroups
+	}
+	var killed []ProcessGroup
+	for _, group := range groups {
+		if group.owned() {
+			killProcessGroup(group.PGID)
+			killed = append(killed, group)
+		}
+	}
+	deadline := time.Now().Add(timeout)
+	for _, group := range killed {
+		for processGroupExists(group.PGID) {
+			if !time.Now().Before(deadline) {
+				return fmt.Errorf("process group %d of job %s is still running after SIGKILL", group.PGID, job.JobID)
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+	}
+	DeleteLogWithFile(job.JobID, logFile)
+	return nil
+}
+
+// ProcessGroup identifies the process group of a running command
+type ProcessGroup struct {
+	PGID  int    `json:"pgid"`
+	Start uint64 `json:"start,omitempty"` // start time of the group leader in clock ticks since boot, Linux only
+}
+
+// owned reports whether the recorded group still exists and was not replaced by
+// another group with a reused PGID
+func (g ProcessGroup) owned() bool {
+	if g.Start != 0 {
+		if start, err := processStartTime(g.PGID); err != nil || start != g.Start {
+			return false
+		}
+	}
+	return processGroupExists(g.PGID)
+}
+
+// jobEntry returns the state entry of a job, whether it is running or not
+func jobEntry(jobID string, logFile string) (JobState, bool) {
+	stateMutex.Lock()
+	jobs, err := readStateFile(logFile)
+	stateMutex.Unlock()
+
+	if err != nil {
+		return JobState{}, false
+	}
+	for _, job := range jobs {
+		if job.JobID == jobID {
+			return job, true
+		}
+	}
+	return JobState{}, false
+}
+
+// sendControlRequest records a control request for the supervisor of a job and
+// signals it to take the request
+func sendControlRequest(job JobState, request string, logFile string) error {
+	if err := setControlRequest(job.JobID, request, logFile); err != nil {
+		return err
+	}
+	if err := signalProcess(job.PID, syscall.SIGHUP); err != nil {
+		setControlRequest(job.JobID, "", logFile)
+		return err
+	}
+	return nil
+}
+
+func setControlRequest(jobID string, request string, logFile string) error {
+	return updateJob(jobID, logFile, func(job *JobState) {
+		job.Request = request
+	})
+}
+
+// takeControlRequest returns and clears the control request pending for a job.
+// The process groups of the running commands are recorded along with it, so
+// that run4ever kill can still reach them if the supervisor does not exit.
+func takeControlRequest(jobID string) (string, error) {
+	return takeControlRequestWithFile(jobID, runningProcessGroups(), GetStateFile())
+}
+
+func takeControlRequestWithFile(jobID string, groups []ProcessGroup, logFile string) (string, error) {
+	var request string
+	err := updateJob(jobID, logFile, func(job *JobState) {
+		request = job.Request
+		job.Request = ""
+		job.ProcessGroups = groups
+	})
+	return request, err
+}
+
+// waitForJobExit waits up to timeout for the supervisor of a job to exit
+func waitForJobExit(job JobState, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for isJobRunning(job) {
+		if !time.Now().Before(deadline) {
+			return false
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return true
+}
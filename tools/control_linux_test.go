@@ -0,0 +1,364 @@
+package tools
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// startJobHelper runs a job in a signal helper process registered in its state
+// file and waits for the command to start. It returns the state file and a
+// channel receiving the helper's exit code.
+func startJobHelper(t *testing.T, script string) (string, string, <-chan int) {
+	t.Helper()
+	dir, stateFile, exited := launchJobHelper(t, script)
+	waitForFile(t, filepath.Join(dir, "started"), 1)
+	return dir, stateFile, exited
+}
+
+// launchJobHelper starts the helper of startJobHelper without waiting for it.
+// The helper is reaped as soon as it exits, so that it is not seen as running.
+func launchJobHelper(t *testing.T, script string, env ...string) (string, string, <-chan int) {
+	t.Helper()
+	dir := t.TempDir()
+	cmd := exec.Command(os.Args[0], "-test.run=^TestSignalHelper$")
+	cmd.Env = append(os.Environ(),
+		"RUN4EVER_TEST_SIGNALS=1",
+		"RUN4EVER_TEST_JOB=job-1",
+		"RUN4EVER_TEST_SCRIPT="+script,
+		"HOME="+dir,
+		"OUT_DIR="+dir,
+	)
+	cmd.Env = append(cmd.Env, env...)
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("Failed to start helper: %v", err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+	})
+
+	exited := make(chan int, 1)
+	go func() {
+		cmd.Wait()
+		exited <- cmd.ProcessState.ExitCode()
+	}()
+	return dir, filepath.Join(dir, ".run4ever", "state.json"), exited
+}
+
+func helperExitCode(t *testing.T, exited <-chan int) int {
+	t.Helper()
+	select {
+	case code := <-exited:
+		return code
+	case <-time.After(10 * time.Second):
+		t.Fatal("Helper did not exit")
+		return 0
+	}
+}
+
+func TestFindRunningJobs(t *testing.T) {
+	logFile := setupTestLogFile(t)
+	InitStateFile(logFile)
+	pid := os.Getpid()
+	RegisterJobWithFile("sleep", []string{"60"}, pid, "3f2a1b", "backup", []string{"nightly"}, logFile)
+	RegisterJobWithFile("sleep", []string{"60"}, pid, "7e6d", "", []string{"nightly", "web"}, logFile)
+	writeStateFile(logFile, append(mustReadState(t, logFile),
+		JobState{JobID: "9c8d", Name: "web", PID: 1 << 30, Command: "sleep", IsStale: true},
+		JobState{JobID: "4b4b", Name: "gone", PID: 1 << 30, Command: "sleep", IsStale: true}))
+
+	tests := []struct {
+		name    string
+		query   string
+		want    []string
+		wantErr bool
+	}{
+		{"by name", "backup", []string{"3f2a1b"}, false},
+		{"by full ID", "7e6d", []string{"7e6d"}, false},
+		{"by prefix", "3f", []string{"3f2a1b"}, false},
+		{"by tag", "nightly", []string{"3f2a1b", "7e6d"}, false},
+		{"tag before the name of a stale job", "web", []string{"7e6d"}, false},
+		{"stale job", "gone", nil, true},
+		{"unknown", "nope", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jobs, err := findRunningJobs(tt.query, logFile)
+			var got []string
+			for _, job := range jobs {
+				got = append(got, job.JobID)
+			}
+			if (err != nil) != tt.wantErr || strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("findRunningJobs(%q) = %v, %v, want %v (error %v)", tt.query, got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRegisterJobRejectsDuplicateName(t *testing.T) {
+	logFile := setupTestLogFile(t)
+	InitStateFile(logFile)
+	if err := RegisterJobWithFile("sleep", nil, os.Getpid(), "job-1", "backup", nil, logFile); err != nil {
+		t.Fatalf("RegisterJobWithFile() error: %v", err)
+	}
+	if err := RegisterJobWithFile("sleep", nil, os.Getpid(), "job-2", "backup", nil, logFile); err == nil {
+		t.Error("Expected an error for a name used by a running job")
+	}
+
+	// The name of a job whose process is gone can be taken over
+	writeStateFile(logFile, []JobState{{JobID: "job-1", Name: "backup", PID: 1 << 30, Command: "sleep", IsStale: true}})
+	if err := RegisterJobWithFile("sleep", nil, os.Getpid(), "job-3", "backup", []string{"nightly"}, logFile); err != nil {
+		t.Fatalf("RegisterJobWithFile() error: %v", err)
+	}
+	if jobs := mustReadState(t, logFile); len(jobs) != 2 || jobs[1].Name != "backup" || !containsString(jobs[1].Tags, "nightly") {
+		t.Errorf("Expected the new job with its name and tags, got %+v", jobs)
+	}
+}
+
+// findJob returns the only running job matching query
+func findJob(t *testing.T, query string, logFile string) JobState {
+	t.Helper()
+	jobs, err := findRunningJobs(query, logFile)
+	if err != nil || len(jobs) != 1 {
+		t.Fatalf("findRunningJobs(%q) = %+v, %v", query, jobs, err)
+	}
+	return jobs[0]
+}
+
+func TestStopJob(t *testing.T) {
+	_, stateFile, exited := startJobHelper(t, `trap 'exit 7' TERM; echo started >> "$OUT_DIR/started"; while true; do sleep 0.1; done`)
+	job := findJob(t, "job-1", stateFile)
+
+	if err := StopJob(job, 5*time.Second); err != nil {
+		t.Fatalf("StopJob() error: %v", err)
+	}
+	if code := helperExitCode(t, exited); code != 7 {
+		t.Errorf("Expected run4ever to exit with the command's status 7, got %d", code)
+	}
+	if jobs := mustReadState(t, stateFile); containsJob(jobs, "job-1") {
+		t.Errorf("Stopped job is still in the state file: %+v", jobs)
+	}
+}
+
+func TestRestartJob(t *testing.T) {
+	dir, stateFile, exited := startJobHelper(t, `echo started >> "$OUT_DIR/started"; while true; do sleep 0.1; done`)
+	job := findJob(t, "job-1", stateFile)
+
+	if err := restartJobWithFile(job, 5*time.Second, stateFile); err != nil {
+		t.Fatalf("RestartJob() error: %v", err)
+	}
+	waitForFile(t, filepath.Join(dir, "started"), 2)
+
+	jobs := mustReadState(t, stateFile)
+	if len(jobs) != 1 || jobs[0].Request != "" || jobs[0].RetryCount != 0 {
+		t.Fatalf("Expected the job to run on with no request pending and no retry counted, got %+v", jobs)
+	}
+	// The restart stops the command with SIGTERM instead of forwarding SIGHUP
+	if code := jobs[0].LastExitCode; code == nil || *code != 128+int(syscall.SIGTERM) {
+		t.Errorf("Expected the interrupted run to exit with status %d, got %v", 128+int(syscall.SIGTERM), code)
+	}
+	syscall.Kill(job.PID, syscall.SIGTERM)
+	helperExitCode(t, exited)
+}
+
+func TestRestartJobStartedWithHUPIgnored(t *testing.T) {
+	script := `trap 'echo hup >> "$OUT_DIR/hup"' HUP; echo started >> "$OUT_DIR/started"; while true; do sleep 0.1; done`
+	dir, stateFile, exited := launchJobHelper(t, script, "RUN4EVER_TEST_IGNORE_HUP=1")
+	waitForFile(t, filepath.Join(dir, "started"), 1)
+	job := findJob(t, "job-1", stateFile)
+
+	// A hangup is neither forwarded nor ends run4ever
+	syscall.Kill(job.PID, syscall.SIGHUP)
+	time.Sleep(500 * time.Millisecond)
+	if _, err := os.Stat(filepath.Join(dir, "hup")); err == nil {
+		t.Error("SIGHUP was forwarded to the command")
+	}
+	select {
+	case code := <-exited:
+		t.Fatalf("run4ever exited with %d on SIGHUP", code)
+	default:
+	}
+
+	// Control requests still arrive
+	if err := restartJobWithFile(job, 5*time.Second, stateFile); err != nil {
+		t.Fatalf("RestartJob() error: %v", err)
+	}
+	waitForFile(t, filepath.Join(dir, "started"), 2)
+	syscall.Kill(job.PID, syscall.SIGTERM)
+	helperExitCode(t, exited)
+}
+
+func TestKillJob(t *testing.T) {
+	_, stateFile, exited := startJobHelper(t, `trap '' TERM; echo started >> "$OUT_DIR/started"; while true; do sleep 0.1; done`)
+	job := findJob(t, "job-1", stateFile)
+
+	start := time.Now()
+	if err := killJobWithFile(job, 5*time.Second, stateFile); err != nil {
+		t.Fatalf("KillJob() error: %v", err)
+	}
+	if code := helperExitCode(t, exited); code != 128+int(syscall.SIGKILL) {
+		t.Errorf("Expected exit status %d, got %d", 128+int(syscall.SIGKILL), code)
+	}
+	// The command ignores SIGTERM, so it must not have waited for the stop timeout
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Kill took %v", elapsed)
+	}
+	if jobs := mustReadState(t, stateFile); containsJob(jobs, "job-1") {
+		t.Errorf("Killed job is still in the state file: %+v", jobs)
+	}
+}
+
+func TestKillJobDuringSetup(t *testing.T) {
+	// The job is in the state file long before its first run starts
+	dir, stateFile, exited := launchJobHelper(t, `echo started >> "$OUT_DIR/started"`, "RUN4EVER_TEST_SETUP_DELAY=10s")
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if jobs, err := readStateFile(stateFile); err == nil && containsJob(jobs, "job-1") {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Helper did not register the job")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	job := findJob(t, "job-1", stateFile)
+
+	if err := killJobWithFile(job, 5*time.Second, stateFile); err != nil {
+		t.Fatalf("KillJob() error: %v", err)
+	}
+	if code := helperExitCode(t, exited); code != 128+int(syscall.SIGKILL) {
+		t.Errorf("Expected exit status %d, got %d", 128+int(syscall.SIGKILL), code)
+	}
+	if jobs := mustReadState(t, stateFile); containsJob(jobs, "job-1") {
+		t.Errorf("Killed job is still in the state file: %+v", jobs)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "started")); err == nil {
+		t.Error("The command ran although the job was killed before its first run")
+	}
+}
+
+func TestKillJobUnresponsive(t *testing.T) {
+	logFile := setupTestLogFile(t)
+	InitStateFile(logFile)
+	// A process that ignores SIGHUP stands in for a supervisor that hangs
+	hung := exec.Command("sh", "-c", "trap '' HUP; while true; do sleep 0.1; done")
+	if err := hung.Start(); err != nil {
+		t.Fatalf("Failed to start sh: %v", err)
+	}
+	exited := make(chan struct{})
+	go func() {
+		hung.Wait()
+		close(exited)
+	}()
+	LogWithFile("sh", nil, hung.Process.Pid, "job-1", "", logFile)
+	job := findJob(t, "job-1", logFile)
+
+	if err := killJobWithFile(job, 200*time.Millisecond, logFile); err != nil {
+		t.Fatalf("KillJob() error: %v", err)
+	}
+	select {
+	case <-exited:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Hung process was not killed")
+	}
+	if jobs := mustReadState(t, logFile); containsJob(jobs, "job-1") {
+		t.Errorf("Killed job is still in the state file: %+v", jobs)
+	}
+}
+
+func TestControlRequestRecordsProcessGroups(t *testing.T) {
+	dir, stateFile, _ := startJobHelper(t, `echo $$ > "$OUT_DIR/pid"; echo started >> "$OUT_DIR/started"; while true; do sleep 0.1; done`)
+	job := findJob(t, "job-1", stateFile)
+	if len(job.ProcessGroups) != 0 {
+		t.Fatalf("Process groups recorded before any control request: %v", job.ProcessGroups)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "pid"))
+	if err != nil {
+		t.Fatalf("Failed to read command PID: %v", err)
+	}
+	pgid, _ := strconv.Atoi(strings.TrimSpace(string(data)))
+	start, err := processStartTime(pgid)
+	if err != nil {
+		t.Fatalf("processStartTime() error: %v", err)
+	}
+
+	if err := restartJobWithFile(job, 5*time.Second, stateFile); err != nil {
+		t.Fatalf("RestartJob() error: %v", err)
+	}
+	job = findJob(t, "job-1", stateFile)
+	if len(job.ProcessGroups) != 1 || job.ProcessGroups[0] != (ProcessGroup{PGID: pgid, Start: start}) {
+		t.Errorf("Expected process group %d started at %d, got %v", pgid, start, job.ProcessGroups)
+	}
+}
+
+// startProcessGroup starts a sleep in a process group of its own
+func startProcessGroup(t *testing.T) (*exec.Cmd, ProcessGroup) {
+	t.Helper()
+	cmd := exec.Command("sleep", "60")
+	setProcessGroup(cmd)
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("Failed to start sleep: %v", err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+	start, err := processStartTime(cmd.Process.Pid)
+	if err != nil {
+		t.Fatalf("processStartTime() error: %v", err)
+	}
+	return cmd, ProcessGroup{PGID: cmd.Process.Pid, Start: start}
+}
+
+func TestKillJobUnresponsiveKillsProcessGroups(t *testing.T) {
+	logFile := setupTestLogFile(t)
+	InitStateFile(logFile)
+	hung := exec.Command("sh", "-c", "trap '' HUP; while true; do sleep 0.1; done")
+	if err := hung.Start(); err != nil {
+		t.Fatalf("Failed to start sh: %v", err)
+	}
+	go hung.Wait()
+	LogWithFile("sh", nil, hung.Process.Pid, "job-1", "", logFile)
+
+	// One group of the job, and one whose PGID was reused after the job's group ended
+	owned, ownedGroup := startProcessGroup(t)
+	reused, reusedGroup := startProcessGroup(t)
+	reusedGroup.Start++
+	ownedExited := make(chan struct{})
+	go func() {
+		owned.Wait()
+		close(ownedExited)
+	}()
+	updateJob("job-1", logFile, func(job *JobState) {
+		job.ProcessGroups = []ProcessGroup{ownedGroup, reusedGroup}
+	})
+	job := findJob(t, "job-1", logFile)
+
+	if err := killJobWithFile(job, 200*time.Millisecond, logFile); err != nil {
+		t.Fatalf("KillJob() error: %v", err)
+	}
+	select {
+	case <-ownedExited:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Process group of the job was not killed")
+	}
+	if !processExists(reused.Process.Pid) {
+		t.Error("Process group with a reused PGID was killed")
+	}
+	if jobs := mustReadState(t, logFile); containsJob(jobs, "job-1") {
+		t.Errorf("Killed job is still in the state file: %+v", jobs)
+	}
+}
+
+func mustReadState(t *testing.T, logFile string) []JobState {
+	t.Helper()
+	jobs, err := readStateFile(logFile)
+	if err != nil {
+		t.Fatalf("Failed to read state file: %v", err)
+	}
+	return jobs
+}
@@ -0,0 +1,156 @@
+package tools
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EventLogConfig controls the log of run4ever's own events, such as runs starting
+// and finishing, timeouts and notifications
+type EventLogConfig struct {
+	Format string // "text" or "json", empty for text in File and no event log without it
+	File   string // file the events are appended to, stderr when empty
+}
+
+// eventLogger writes events as text or JSON lines. It is disabled while w is nil.
+type eventLogger struct {
+	mu     sync.Mutex
+	w      io.Writer
+	format string
+	jobID  string
+}
+
+var events = &eventLogger{}
+
+// ValidateLogFormat checks the event log format name
+func ValidateLogFormat(format string) error {
+	switch format {
+	case "", "text", "json":
+		return nil
+	}
+	return fmt.Errorf("invalid log format %q, expected text or json", format)
+}
+
+// OpenEventLog starts logging events. Events are appended to cfg.File, or written
+// to stderr when only a format is given. Without either the event log stays
+// disabled, as the verbose output covers it.
+func OpenEventLog(cfg EventLogConfig) error {
+	if err := ValidateLogFormat(cfg.Format); err != nil {
+		return err
+	}
+	var w io.Writer
+	switch {
+	case cfg.File != "":
+		if err := os.MkdirAll(filepath.Dir(cfg.File), 0755); err != nil {
+			return fmt.Errorf("failed to create log file directory: %w", err)
+		}
+		f, err := os.OpenFile(cfg.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return fmt.Errorf("failed to open log file: %w", err)
+		}
+		w = f
+	case cfg.Format != "":
+		w = os.Stderr
+	default:
+		return nil
+	}
+	format := cfg.Format
+	if format == "" {
+		format = "text"
+	}
+
+	events.mu.Lock()
+	defer events.mu.Unlock()
+	events.w = w
+	events.format = format
+	return nil
+}
+
+// setJob sets the job ID added to every event
+func (l *eventLogger) setJob(jobID string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.jobID = jobID
+}
+
+func (l *eventLogger) info(event string, fields ...interface{}) {
+	l.log("info", event, fields...)
+}
+
+func (l *eventLogger) warn(event string, fields ...interface{}) {
+	l.log("warn", event, fields...)
+}
+
+func (l *eventLogger) error(event string, fields ...interface{}) {
+	l.log("error", event, fields...)
+}
+
+// log writes an event with alternating field names and values
+func (l *eventLogger) log(level string, event string, fields ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.w == nil {
+		return
+	}
+	if l.jobID != "" {
+		fields = append([]interface{}{"job_id", l.jobID}, fields...)
+	}
+	l.w.Write(formatEvent(l.format, time.Now(), level, event, fields))
+}
+
+// formatEvent renders an event as a single line
+func formatEvent(format string, t time.Time, level string, event string, fields []interface{}) []byte {
+	var buf bytes.Buffer
+	timestamp := t.UTC().Format(time.RFC3339Nano)
+
+	if format == "json" {
+		fmt.Fprintf(&buf, `{"time":%q,"level":%q,"event":%q`, timestamp, level, event)
+		for i := 0; i+1 < len(fields); i += 2 {
+			v := fields[i+1]
+			if e, ok := v.(error); ok {
+				v = e.Error()
+			}
+			value, err := json.Marshal(v)
+			if err != nil {
+				value, _ = json.Marshal(fmt.Sprint(v))
+			}
+			fmt.Fprintf(&buf, `,%q:%s`, fields[i], value)
+		}
+		buf.WriteString("}\n")
+		return buf.Bytes()
+	}
+
+	fmt.Fprintf(&buf, "%s %s %s", timestamp, strings.ToUpper(level), event)
+	for i := 0; i+1 < len(fields); i += 2 {
+		fmt.Fprintf(&buf, " %s=%s", fields[i], formatTextValue(fields[i+1]))
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes()
+}
+
+// formatTextValue renders a field value, quoting strings that would be ambiguous
+func formatTextValue(value interface{}) string {
+	var s string
+	switch v := value.(type) {
+	case time.Time:
+		return v.UTC().Format(time.RFC3339Nano)
+	case error:
+		s = v.Error()
+	case string:
+		s = v
+	default:
+		return fmt.Sprint(v)
+	}
+	if s == "" || strings.ContainsAny(s, " =\"\\\t\n") {
+		return strconv.Quote(s)
+	}
+	return s
+}
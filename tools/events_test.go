@@ -0,0 +1,147 @@
+package tools
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormatEvent(t *testing.T) {
+	at := time.Date(2024, 5, 1, 12, 0, 0, 500, time.UTC)
+	fields := []interface{}{
+		"job_id", "3f2a11",
+		"run", 3,
+		"success", false,
+		"title", "run4ever: Task Failed",
+		"error", errors.New(`dial "smtp": refused`),
+		"next_run", time.Date(2024, 5, 1, 13, 0, 0, 0, time.UTC),
+	}
+
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{
+			"text",
+			`2024-05-01T12:00:00.0000005Z WARN run_finished job_id=3f2a11 run=3 success=false title="run4ever: Task Failed" error="dial \"smtp\": refused" next_run=2024-05-01T13:00:00Z` + "\n",
+		},
+		{
+			"json",
+			`{"time":"2024-05-01T12:00:00.0000005Z","level":"warn","event":"run_finished","job_id":"3f2a11","run":3,"success":false,"title":"run4ever: Task Failed","error":"dial \"smtp\": refused","next_run":"2024-05-01T13:00:00Z"}` + "\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			got := string(formatEvent(tt.format, at, "warn", "run_finished", fields))
+			if got != tt.want {
+				t.Errorf("formatEvent() =\n%s\nwant\n%s", got, tt.want)
+			}
+			if tt.format == "json" {
+				var decoded map[string]interface{}
+				if err := json.Unmarshal([]byte(got), &decoded); err != nil {
+					t.Errorf("JSON event does not parse: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestEventLogger(t *testing.T) {
+	var buf bytes.Buffer
+	l := &eventLogger{}
+	l.info("run_started", "run", 1)
+	if buf.Len() != 0 {
+		t.Fatal("disabled logger wrote an event")
+	}
+
+	l.w, l.format = &buf, "json"
+	l.setJob("3f2a11")
+	l.error("notification_failed", "method", "slack")
+	var event map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &event); err != nil {
+		t.Fatalf("invalid event %q: %v", buf.String(), err)
+	}
+	if event["level"] != "error" || event["event"] != "notification_failed" || event["job_id"] != "3f2a11" || event["method"] != "slack" {
+		t.Errorf("unexpected event %v", event)
+	}
+}
+
+func TestOpenEventLog(t *testing.T) {
+	defer func() { events = &eventLogger{} }()
+
+	if err := OpenEventLog(EventLogConfig{Format: "xml"}); err == nil {
+		t.Error("expected an error for an invalid format")
+	}
+
+	events = &eventLogger{}
+	if err := OpenEventLog(EventLogConfig{}); err != nil || events.w != nil {
+		t.Errorf("no format and no file enabled the event log (err %v)", err)
+	}
+	if err := OpenEventLog(EventLogConfig{Format: "text"}); err != nil || events.w != os.Stderr || events.format != "text" {
+		t.Errorf("text format without a file did not log to stderr (err %v)", err)
+	}
+
+	// A file without a format gets text events
+	events = &eventLogger{}
+	file := filepath.Join(t.TempDir(), "logs", "run4ever.log")
+	if err := OpenEventLog(EventLogConfig{File: file}); err != nil {
+		t.Fatalf("OpenEventLog() error: %v", err)
+	}
+	events.info("job_started", "pid", 42)
+	events.info("sleeping", "duration_ms", 1000)
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("failed to read log file: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 || !strings.HasSuffix(lines[0], " INFO job_started pid=42") || !strings.HasSuffix(lines[1], " INFO sleeping duration_ms=1000") {
+		t.Errorf("unexpected log file contents:\n%s", data)
+	}
+}
+
+func TestExecuteLogsEvents(t *testing.T) {
+	setupTestLogFile(t)
+	var buf bytes.Buffer
+	events = &eventLogger{w: &buf, format: "json"}
+	defer func() { events = &eventLogger{} }()
+
+	r := &runner{args: []string{"sh", "-c", "exit 3"}}
+	r.recordRun(r.execute())
+
+	var names []string
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var event map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			t.Fatalf("invalid event %q: %v", line, err)
+		}
+		names = append(names, event["event"].(string))
+		if event["event"] == "run_finished" && (event["exit_code"] != float64(3) || event["success"] != false || event["level"] != "warn") {
+			t.Errorf("unexpected run_finished event %v", event)
+		}
+	}
+	if strings.Join(names, ",") != "run_started,run_finished" {
+		t.Errorf("got events %v, want run_started and run_finished", names)
+	}
+}
+
+func TestDoNotifyLogsFailure(t *testing.T) {
+	var buf bytes.Buffer
+	events = &eventLogger{w: &buf, format: "json"}
+	defer func() { events = &eventLogger{} }()
+
+	doNotify("always", "carrier-pigeon", false, "title", "message")
+
+	var event map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &event); err != nil {
+		t.Fatalf("invalid event %q: %v", buf.String(), err)
+	}
+	if event["event"] != "notification_failed" || event["method"] != "carrier-pigeon" || !strings.Contains(fmt.Sprint(event["error"]), "unknown notification method") {
+		t.Errorf("unexpected event %v", event)
+	}
+}
@@ -0,0 +1,54 @@
+package tools
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ExitCodes classifies command exit statuses. An empty success set means only 0 is a success.
+type ExitCodes struct {
+	Success []int
+	Fatal   []int
+}
+
+// IsSuccess reports whether the exit status counts as a successful run
+func (c ExitCodes) IsSuccess(exitStatus int) bool {
+	if len(c.Success) == 0 {
+		return exitStatus == 0
+	}
+	return containsCode(c.Success, exitStatus)
+}
+
+// IsFatal reports whether the exit status should stop the loop without further retries
+func (c ExitCodes) IsFatal(exitStatus int) bool {
+	return containsCode(c.Fatal, exitStatus)
+}
+
+// Validate checks that no exit status is both a success and fatal
+func (c ExitCodes) Validate() error {
+	for _, code := range c.Fatal {
+		if c.IsSuccess(code) {
+			return fmt.Errorf("exit code %d cannot be both a success and a fatal code", code)
+		}
+	}
+	return nil
+}
+
+func containsCode(codes []int, exitStatus int) bool {
+	for _, code := range codes {
+		if code == exitStatus {
+			return true
+		}
+	}
+	return false
+}
+
+// formatExitCodes joins exit codes into the comma separated form accepted by the flags
+func formatExitCodes(codes []int) string {
+	parts := make([]string, len(codes))
+	for i, code := range codes {
+		parts[i] = strconv.Itoa(code)
+	}
+	return strings.Join(parts, ",")
+}
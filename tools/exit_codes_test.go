@@ -0,0 +1,41 @@
+package tools
+
+import "testing"
+
+func TestExitCodes(t *testing.T) {
+	defaults := ExitCodes{}
+	if !defaults.IsSuccess(0) || defaults.IsSuccess(1) {
+		t.Error("Default exit codes should only treat 0 as success")
+	}
+	if defaults.IsFatal(1) {
+		t.Error("Default exit codes should have no fatal codes")
+	}
+
+	codes := ExitCodes{Success: []int{0, 1, 3}, Fatal: []int{2, 127}}
+	for _, code := range []int{0, 1, 3} {
+		if !codes.IsSuccess(code) {
+			t.Errorf("Expected %d to be a success code", code)
+		}
+	}
+	if codes.IsSuccess(2) || !codes.IsFatal(2) || !codes.IsFatal(127) || codes.IsFatal(4) {
+		t.Error("Fatal codes not classified correctly")
+	}
+}
+
+func TestExitCodesValidate(t *testing.T) {
+	if err := (ExitCodes{Success: []int{0, 1}, Fatal: []int{2}}).Validate(); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if err := (ExitCodes{Success: []int{0, 1}, Fatal: []int{1}}).Validate(); err == nil {
+		t.Error("Expected error when a code is both success and fatal")
+	}
+	if err := (ExitCodes{Fatal: []int{0}}).Validate(); err == nil {
+		t.Error("Expected error when 0 is fatal with default success codes")
+	}
+}
+
+func TestFormatExitCodes(t *testing.T) {
+	if got := formatExitCodes([]int{0, 1, 3}); got != "0,1,3" {
+		t.Errorf("formatExitCodes() = %s, want 0,1,3", got)
+	}
+}
@@ -0,0 +1,60 @@
+package tools
+
+import (
+	"fmt"
+	"time"
+)
+
+// FailureBudget opens the circuit breaker once too many runs fail within a sliding window
+type FailureBudget struct {
+	MaxFailures    int           // failures allowed before the breaker opens, 0 to disable
+	Window         time.Duration // only failures within this window count, 0 counts all failures
+	ResetOnSuccess bool          // forget earlier failures after a successful run
+}
+
+// failureWindow records the failure times tracked by a FailureBudget
+type failureWindow struct {
+	budget   FailureBudget
+	failures []time.Time
+}
+
+func newFailureWindow(budget FailureBudget) *failureWindow {
+	return &failureWindow{budget: budget}
+}
+
+// record adds the outcome of a run and reports whether the budget is exhausted
+func (w *failureWindow) record(success bool, now time.Time) bool {
+	if w.budget.MaxFailures <= 0 {
+		return false
+	}
+	if success {
+		if w.budget.ResetOnSuccess {
+			w.failures = nil
+		}
+		return false
+	}
+
+	w.failures = append(w.failures, now)
+	if w.budget.Window > 0 {
+		cutoff := now.Add(-w.budget.Window)
+		i := 0
+		for i < len(w.failures) && !w.failures[i].After(cutoff) {
+			i++
+		}
+		w.failures = w.failures[i:]
+	}
+	return len(w.failures) >= w.budget.MaxFailures
+}
+
+// reset forgets all recorded failures
+func (w *failureWindow) reset() {
+	w.failures = nil
+}
+
+// describe explains the exhausted budget for notifications
+func (w *failureWindow) describe() string {
+	if w.budget.Window > 0 {
+		return fmt.Sprintf("%d failures within %s", len(w.failures), w.budget.Window)
+	}
+	return fmt.Sprintf("%d failures", len(w.failures))
+}
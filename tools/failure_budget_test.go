@@ -0,0 +1,51 @@
+package tools
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFailureWindow(t *testing.T) {
+	start := time.Date(2024, time.March, 15, 10, 0, 0, 0, time.UTC)
+	w := newFailureWindow(FailureBudget{MaxFailures: 3, Window: 10 * time.Minute})
+
+	if w.record(false, start) || w.record(false, start.Add(5*time.Minute)) {
+		t.Fatal("Breaker should not open before the budget is exhausted")
+	}
+	// The first failure leaves the window before the third one arrives
+	if w.record(false, start.Add(11*time.Minute)) {
+		t.Fatal("Failures outside the window should not count")
+	}
+	if !w.record(false, start.Add(12*time.Minute)) {
+		t.Fatal("Breaker should open after three failures within the window")
+	}
+}
+
+func TestFailureWindowResetOnSuccess(t *testing.T) {
+	now := time.Now()
+	w := newFailureWindow(FailureBudget{MaxFailures: 2, ResetOnSuccess: true})
+	w.record(false, now)
+	w.record(true, now)
+	if w.record(false, now) {
+		t.Fatal("Success should reset the failure count")
+	}
+	if !w.record(false, now) {
+		t.Fatal("Breaker should open after two consecutive failures")
+	}
+
+	w = newFailureWindow(FailureBudget{MaxFailures: 2})
+	w.record(false, now)
+	w.record(true, now)
+	if !w.record(false, now) {
+		t.Fatal("Without reset, failures before a success should still count")
+	}
+}
+
+func TestFailureWindowDisabled(t *testing.T) {
+	w := newFailureWindow(FailureBudget{})
+	for i := 0; i < 100; i++ {
+		if w.record(false, time.Now()) {
+			t.Fatal("Disabled budget should never open the breaker")
+		}
+	}
+}
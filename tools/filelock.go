@@ -0,0 +1,36 @@
+package tools
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// fileLock is an exclusive advisory lock shared by all run4ever processes
+type fileLock struct {
+	f *os.File
+}
+
+// lockFile takes the lock guarding path, waiting for other processes to release
+// it. The lock is held on a separate <path>.lock file, because the state and jobs
+// files are replaced by a rename on every write.
+func lockFile(path string) (*fileLock, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create lock directory: %w", err)
+	}
+	f, err := os.OpenFile(path+".lock", os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file: %w", err)
+	}
+	if err := lockHandle(f); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to lock %s: %w", path, err)
+	}
+	return &fileLock{f: f}, nil
+}
+
+// unlock releases the lock
+func (l *fileLock) unlock() {
+	// Closing the file releases the lock
+	l.f.Close()
+}
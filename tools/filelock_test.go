@@ -0,0 +1,130 @@
+package tools
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLockFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sub", "state.json")
+	first, err := lockFile(path)
+	if err != nil {
+		t.Fatalf("lockFile() error: %v", err)
+	}
+
+	acquired := make(chan *fileLock)
+	go func() {
+		second, err := lockFile(path)
+		if err != nil {
+			t.Errorf("lockFile() error: %v", err)
+		}
+		acquired <- second
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("second lock was acquired while the first was held")
+	case <-time.After(100 * time.Millisecond):
+	}
+	first.unlock()
+	select {
+	case second := <-acquired:
+		second.unlock()
+	case <-time.After(5 * time.Second):
+		t.Fatal("second lock was not acquired after the first was released")
+	}
+}
+
+func TestStateLockHelper(t *testing.T) {
+	jobID := os.Getenv("RUN4EVER_TEST_LOCK_JOB")
+	if jobID == "" {
+		t.Skip("helper process for the state locking test")
+	}
+	if os.Getenv("RUN4EVER_TEST_LOCK_DELETE") == "1" {
+		DeleteLog(jobID)
+		return
+	}
+	LogWithJobID("sleep", []string{jobID}, os.Getpid(), jobID, "")
+	if err := SaveJobDefinition(JobDefinition{Command: []string{"sleep", jobID}, Delay: 10, MaxRetries: -1}); err != nil {
+		t.Fatalf("SaveJobDefinition() error: %v", err)
+	}
+}
+
+// runLockHelpers starts one helper process per job at once and waits for all of them
+func runLockHelpers(t *testing.T, home string, jobIDs []string, remove bool) {
+	t.Helper()
+	var wg sync.WaitGroup
+	for _, jobID := range jobIDs {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestStateLockHelper$")
+		cmd.Env = append(os.Environ(), "HOME="+home, "RUN4EVER_TEST_LOCK_JOB="+jobID)
+		if remove {
+			cmd.Env = append(cmd.Env, "RUN4EVER_TEST_LOCK_DELETE=1")
+		}
+		wg.Add(1)
+		go func(jobID string) {
+			defer wg.Done()
+			if out, err := cmd.CombinedOutput(); err != nil {
+				t.Errorf("helper for %s failed: %v\n%s", jobID, err, out)
+			}
+		}(jobID)
+	}
+	wg.Wait()
+}
+
+func TestConcurrentStateWriters(t *testing.T) {
+	if testing.Short() {
+		t.Skip("starts many processes")
+	}
+	home := t.TempDir()
+	stateFile := filepath.Join(home, ".run4ever", "state.json")
+	os.MkdirAll(filepath.Dir(stateFile), 0755)
+	InitStateFile(stateFile)
+
+	const writers = 40
+	var jobIDs []string
+	for i := 0; i < writers; i++ {
+		jobIDs = append(jobIDs, fmt.Sprintf("job-%02d", i))
+	}
+	runLockHelpers(t, home, jobIDs, false)
+
+	jobs, err := readStateFile(stateFile)
+	if err != nil {
+		t.Fatalf("Failed to read state file: %v", err)
+	}
+	if len(jobs) != writers {
+		t.Errorf("state file has %d jobs, want %d", len(jobs), writers)
+	}
+	definitions, err := loadJobDefinitions(filepath.Join(home, ".run4ever", "jobs.json"))
+	if err != nil {
+		t.Fatalf("Failed to read jobs file: %v", err)
+	}
+	if len(definitions) != writers {
+		t.Errorf("jobs file has %d definitions, want %d", len(definitions), writers)
+	}
+
+	// Remove half of the jobs concurrently, the others must survive
+	runLockHelpers(t, home, jobIDs[:writers/2], true)
+	jobs, _ = readStateFile(stateFile)
+	if len(jobs) != writers/2 {
+		t.Fatalf("state file has %d jobs after the deletes, want %d", len(jobs), writers/2)
+	}
+	for _, jobID := range jobIDs[writers/2:] {
+		if !containsJob(jobs, jobID) {
+			t.Errorf("job %s was lost", jobID)
+		}
+	}
+}
+
+func containsJob(jobs []JobState, jobID string) bool {
+	for _, job := range jobs {
+		if job.JobID == jobID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,213 @@
+package tools
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// SignalConfig controls how signals received by run4ever reach the running command
+type SignalConfig struct {
+	Forward     []syscall.Signal // signals passed on to the running command
+	StopTimeout time.Duration    // how long to wait for the command after a forwarded SIGINT/SIGTERM
+	HUPRestart  bool             // SIGHUP restarts the command instead of being forwarded
+}
+
+var (
+	signalChan   = make(chan os.Signal, 1)
+	wakeChan     = make(chan struct{}, 1)
+	signalConfig *SignalConfig
+
+	// hupIgnored is set when run4ever was started with SIGHUP ignored, as nohup
+	// does for -g. SIGHUP is then only taken for control requests.
+	hupIgnored bool
+
+	// The fields below are guarded by runningMutex
+	stopSignal     syscall.Signal
+	restartPending int
+	controlJobID   string
+)
+
+var errStopping = errors.New("run4ever is stopping")
+
+// HandleSignals makes run4ever clean up its running commands and state entry
+// when it is interrupted. Once RunInfinitely starts, signals are handled
+// according to its SignalConfig instead.
+func HandleSignals() {
+	hupIgnored = signal.Ignored(syscall.SIGHUP)
+	signal.Notify(signalChan, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	go func() {
+		for sig := range signalChan {
+			handleSignal(sig.(syscall.Signal))
+		}
+	}()
+}
+
+// WatchControlRequests makes SIGHUP take the requests of run4ever restart and
+// run4ever kill for the job. It must be called before the job's state entry is
+// written, so that no request arrives while SIGHUP still has its default action.
+func WatchControlRequests(jobID string) {
+	runningMutex.Lock()
+	defer runningMutex.Unlock()
+	controlJobID = jobID
+}
+
+// watchSignals starts handling the signals of the given configuration
+func watchSignals(cfg SignalConfig) {
+	runningMutex.Lock()
+	signalConfig = &cfg
+	runningMutex.Unlock()
+
+	var extra []os.Signal
+	for _, sig := range cfg.Forward {
+		extra = append(extra, sig)
+	}
+	if cfg.HUPRestart {
+		extra = append(extra, syscall.SIGHUP)
+	}
+	if len(extra) > 0 {
+		signal.Notify(signalChan, extra...)
+	}
+}
+
+func handleSignal(sig syscall.Signal) {
+	runningMutex.Lock()
+	cfg := signalConfig
+	jobID := controlJobID
+	runningMutex.Unlock()
+
+	if sig == syscall.SIGHUP && jobID != "" {
+		// Requests from run4ever restart and run4ever kill
+		request, err := takeControlRequest(jobID)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading control request: %v\n", err)
+		}
+		switch request {
+		case controlRestart:
+			// Before RunInfinitely starts there is no run to restart yet
+			if cfg != nil {
+				requestRestart(cfg.StopTimeout)
+			}
+			return
+		case controlKill:
+			exitOnSignal(128 + int(syscall.SIGKILL))
+			return
+		}
+	}
+
+	switch {
+	case sig == syscall.SIGHUP && hupIgnored && (cfg == nil || !cfg.HUPRestart):
+		// A hangup that run4ever was started to ignore
+	case cfg == nil:
+		exitOnSignal(1)
+	case sig == syscall.SIGHUP && cfg.HUPRestart:
+		requestRestart(cfg.StopTimeout)
+	case !containsSignal(cfg.Forward, sig):
+		exitOnSignal(1)
+	case sig == syscall.SIGINT || sig == syscall.SIGTERM:
+		requestStop(sig, cfg.StopTimeout)
+	default:
+		runningMutex.Lock()
+		for cmd := range runningCommands {
+			signalProcessGroup(cmd, sig)
+		}
+		runningMutex.Unlock()
+	}
+}
+
+// exitOnSignal kills running commands, removes the state entry and exits
+func exitOnSignal(code int) {
+	KillRunningCommands()
+	DeleteLogByPID(os.Getpid())
+	os.Exit(code)
+}
+
+// requestStop forwards a stop signal to the running commands. The run loop exits
+// with the command's status once it finishes, or right away if nothing is running.
+func requestStop(sig syscall.Signal, stopTimeout time.Duration) {
+	runningMutex.Lock()
+	stopSignal = sig
+	running := len(runningCommands)
+	for cmd := range runningCommands {
+		signalProcessGroup(cmd, sig)
+	}
+	runningMutex.Unlock()
+
+	if running == 0 {
+		exitOnSignal(128 + int(sig))
+	}
+	killAfter(stopTimeout)
+}
+
+// requestRestart stops the running commands so a fresh run starts immediately
+func requestRestart(stopTimeout time.Duration) {
+	runningMutex.Lock()
+	restartPending = len(runningCommands)
+	for cmd := range runningCommands {
+		signalProcessGroup(cmd, syscall.SIGTERM)
+	}
+	running := restartPending
+	runningMutex.Unlock()
+
+	if running == 0 {
+		wake()
+		return
+	}
+	killAfter(stopTimeout)
+}
+
+// killAfter kills the commands still running once the stop timeout expires
+func killAfter(stopTimeout time.Duration) {
+	if stopTimeout <= 0 {
+		return
+	}
+	time.AfterFunc(stopTimeout, KillRunningCommands)
+}
+
+// stopRequested returns the stop signal forwarded to the commands, if any
+func stopRequested() (syscall.Signal, bool) {
+	runningMutex.Lock()
+	defer runningMutex.Unlock()
+	return stopSignal, stopSignal != 0
+}
+
+// takeRestart reports whether a finished run was stopped to be restarted
+func takeRestart() bool {
+	runningMutex.Lock()
+	defer runningMutex.Unlock()
+	if restartPending > 0 {
+		restartPending--
+		return true
+	}
+	return false
+}
+
+// wake interrupts a pending sleep between runs
+func wake() {
+	select {
+	case wakeChan <- struct{}{}:
+	default:
+	}
+}
+
+// sleepOrWake sleeps for d unless a restart is requested first
+func sleepOrWake(d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-wakeChan:
+	}
+}
+
+func containsSignal(signals []syscall.Signal, sig syscall.Signal) bool {
+	for _, s := range signals {
+		if s == sig {
+			return true
+		}
+	}
+	return false
+}
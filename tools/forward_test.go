@@ -0,0 +1,156 @@
+//go:build linux
+
+package tools
+
+import (
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// startSignalHelper runs RunInfinitely in a subprocess with the given command
+// and signal configuration, so that signals can be sent to it
+func startSignalHelper(t *testing.T, script string, hupRestart bool) (*exec.Cmd, string) {
+	t.Helper()
+	dir := t.TempDir()
+	cmd := exec.Command(os.Args[0], "-test.run=^TestSignalHelper$")
+	cmd.Env = append(os.Environ(),
+		"RUN4EVER_TEST_SIGNALS=1",
+		"RUN4EVER_TEST_SCRIPT="+script,
+		"HOME="+dir,
+		"OUT_DIR="+dir,
+	)
+	if hupRestart {
+		cmd.Env = append(cmd.Env, "RUN4EVER_TEST_HUP_RESTART=1")
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("Failed to start helper: %v", err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+	})
+	return cmd, dir
+}
+
+func TestSignalHelper(t *testing.T) {
+	if os.Getenv("RUN4EVER_TEST_SIGNALS") != "1" {
+		t.Skip("helper process for signal tests")
+	}
+	if os.Getenv("RUN4EVER_TEST_IGNORE_HUP") == "1" {
+		// As started by nohup
+		signal.Ignore(syscall.SIGHUP)
+	}
+	HandleSignals()
+	jobID := os.Getenv("RUN4EVER_TEST_JOB")
+	if jobID != "" {
+		WatchControlRequests(jobID)
+		LogWithJobID("sh", nil, os.Getpid(), jobID, "")
+	}
+	if delay, err := time.ParseDuration(os.Getenv("RUN4EVER_TEST_SETUP_DELAY")); err == nil {
+		time.Sleep(delay)
+	}
+	RunInfinitely(30, 0, []string{"sh", "-c", os.Getenv("RUN4EVER_TEST_SCRIPT")}, false, -1, "", "", "", "", "", false, "", "", "", "", "", 0,
+		RunOptions{JobID: jobID, Signals: SignalConfig{
+			Forward:     []syscall.Signal{syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP, syscall.SIGUSR1, syscall.SIGUSR2},
+			StopTimeout: 2 * time.Second,
+			HUPRestart:  os.Getenv("RUN4EVER_TEST_HUP_RESTART") == "1",
+		}})
+}
+
+// waitForFile waits until the file exists and contains at least n lines
+func waitForFile(t *testing.T, path string, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		data, err := os.ReadFile(path)
+		if err == nil && len(strings.Split(strings.TrimSpace(string(data)), "\n")) >= n && len(data) > 0 {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatalf("Timed out waiting for %d line(s) in %s", n, path)
+}
+
+// waitExitCode waits for the helper to exit and returns its exit code
+func waitExitCode(t *testing.T, cmd *exec.Cmd) int {
+	t.Helper()
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+	select {
+	case err := <-done:
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return exitErr.ExitCode()
+		}
+		if err != nil {
+			t.Fatalf("Helper failed: %v", err)
+		}
+		return 0
+	case <-time.After(10 * time.Second):
+		t.Fatal("Helper did not exit")
+		return 0
+	}
+}
+
+func TestForwardStopSignal(t *testing.T) {
+	cmd, dir := startSignalHelper(t, `trap 'exit 7' TERM; echo started >> "$OUT_DIR/started"; while true; do sleep 0.1; done`, false)
+	waitForFile(t, filepath.Join(dir, "started"), 1)
+
+	cmd.Process.Signal(syscall.SIGTERM)
+	if code := waitExitCode(t, cmd); code != 7 {
+		t.Errorf("Expected run4ever to exit with the command's status 7, got %d", code)
+	}
+}
+
+func TestStopTimeoutKillsCommand(t *testing.T) {
+	cmd, dir := startSignalHelper(t, `trap '' TERM; echo started >> "$OUT_DIR/started"; while true; do sleep 0.1; done`, false)
+	waitForFile(t, filepath.Join(dir, "started"), 1)
+
+	start := time.Now()
+	cmd.Process.Signal(syscall.SIGTERM)
+	if code := waitExitCode(t, cmd); code != 137 {
+		t.Errorf("Expected exit status 137 after stop timeout, got %d", code)
+	}
+	if elapsed := time.Since(start); elapsed < 2*time.Second {
+		t.Errorf("Command was killed before the stop timeout, after %v", elapsed)
+	}
+}
+
+func TestStopSignalWhileSleeping(t *testing.T) {
+	cmd, dir := startSignalHelper(t, `echo started >> "$OUT_DIR/started"`, false)
+	waitForFile(t, filepath.Join(dir, "started"), 1)
+	time.Sleep(200 * time.Millisecond)
+
+	cmd.Process.Signal(syscall.SIGINT)
+	if code := waitExitCode(t, cmd); code != 128+int(syscall.SIGINT) {
+		t.Errorf("Expected exit status %d, got %d", 128+int(syscall.SIGINT), code)
+	}
+}
+
+func TestForwardUserSignal(t *testing.T) {
+	cmd, dir := startSignalHelper(t, `trap 'echo usr1 >> "$OUT_DIR/usr1"' USR1; echo started >> "$OUT_DIR/started"; while true; do sleep 0.1; done`, false)
+	waitForFile(t, filepath.Join(dir, "started"), 1)
+
+	cmd.Process.Signal(syscall.SIGUSR1)
+	waitForFile(t, filepath.Join(dir, "usr1"), 1)
+}
+
+func TestHUPRestart(t *testing.T) {
+	cmd, dir := startSignalHelper(t, `echo started >> "$OUT_DIR/started"; while true; do sleep 0.1; done`, true)
+	started := filepath.Join(dir, "started")
+	waitForFile(t, started, 1)
+
+	cmd.Process.Signal(syscall.SIGHUP)
+	waitForFile(t, started, 2)
+
+	cmd.Process.Signal(syscall.SIGTERM)
+	if code := waitExitCode(t, cmd); code != 128+int(syscall.SIGTERM) {
+		t.Errorf("Expected exit status %d, got %d", 128+int(syscall.SIGTERM), code)
+	}
+}
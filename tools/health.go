@@ -0,0 +1,124 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// HealthStatus is the JSON body of the /healthz and /readyz endpoints
+type HealthStatus struct {
+	Status        string     `json:"status"` // "ok", "ready" or "not ready"
+	Reason        string     `json:"reason,omitempty"`
+	JobID         string     `json:"job_id,omitempty"`
+	JobName       string     `json:"job_name,omitempty"`
+	PID           int        `json:"pid"`
+	UptimeSeconds int64      `json:"uptime_seconds"`
+	Breaker       string     `json:"breaker"`
+	Runs          uint64     `json:"runs"`
+	LastRun       *RunStatus `json:"last_run,omitempty"`
+}
+
+// RunStatus describes the last finished run
+type RunStatus struct {
+	Run        int       `json:"run"`
+	Start      time.Time `json:"start"`
+	End        time.Time `json:"end"`
+	DurationMS int64     `json:"duration_ms"`
+	ExitCode   int       `json:"exit_code"`
+	Success    bool      `json:"success"`
+	Details    string    `json:"details,omitempty"`
+}
+
+// health returns the state of the supervisor, which is healthy as long as it serves
+func (m *jobMetrics) health(now time.Time) HealthStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	status := HealthStatus{
+		Status:        "ok",
+		JobID:         m.jobID,
+		JobName:       m.jobName,
+		PID:           os.Getpid(),
+		UptimeSeconds: int64(now.Sub(m.started).Seconds()),
+		Breaker:       "closed",
+		Runs:          m.runs["success"] + m.runs["failure"],
+	}
+	if m.breaker != "" {
+		status.Breaker = m.breaker
+	}
+	if m.hasRun {
+		status.LastRun = &RunStatus{
+			Run:        m.last.run,
+			Start:      m.last.start,
+			End:        m.last.end,
+			DurationMS: m.last.end.Sub(m.last.start).Milliseconds(),
+			ExitCode:   m.last.exitStatus,
+			Success:    m.lastSuccess,
+			Details:    strings.TrimSuffix(strings.TrimPrefix(m.last.describe(), " ("), ")"),
+		}
+	}
+	return status
+}
+
+// readiness returns the state of the job, which is ready when its last run
+// succeeded, finished within maxAge unless maxAge is 0, and the breaker is closed
+func (m *jobMetrics) readiness(now time.Time, maxAge time.Duration) HealthStatus {
+	status := m.health(now)
+	switch {
+	case status.LastRun == nil:
+		status.Reason = "no run has finished yet"
+	case !status.LastRun.Success:
+		status.Reason = fmt.Sprintf("last run failed with exit status %d", status.LastRun.ExitCode)
+		if status.LastRun.Details != "" {
+			status.Reason += " (" + status.LastRun.Details + ")"
+		}
+	case maxAge > 0 && now.Sub(status.LastRun.End) > maxAge:
+		status.Reason = fmt.Sprintf("last run finished %s ago, longer than %s", now.Sub(status.LastRun.End).Round(time.Second), maxAge)
+	case status.Breaker != "closed":
+		status.Reason = "circuit breaker is " + status.Breaker
+	}
+
+	status.Status = "ready"
+	if status.Reason != "" {
+		status.Status = "not ready"
+	}
+	return status
+}
+
+func healthHandler(m *jobMetrics) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeHealth(w, m.health(time.Now()))
+	})
+}
+
+func readyHandler(m *jobMetrics, maxAge time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeHealth(w, m.readiness(time.Now(), maxAge))
+	})
+}
+
+// writeHealth writes the status as JSON, with 503 Service Unavailable when not ready
+func writeHealth(w http.ResponseWriter, status HealthStatus) {
+	w.Header().Set("Content-Type", "application/json")
+	if status.Reason != "" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.Encode(status)
+}
+
+// ServeHealth serves /healthz, which answers as long as run4ever is running, and
+// /readyz, which answers 200 only while the job is ready, on addr. Readiness
+// requires a successful last run that finished within readyMaxAge, 0 for no
+// limit, and a closed circuit breaker. It returns once the address is bound.
+func ServeHealth(addr string, readyMaxAge time.Duration) error {
+	if err := serveHandler(addr, "/healthz", healthHandler(metrics)); err != nil {
+		return err
+	}
+	return serveHandler(addr, "/readyz", readyHandler(metrics, readyMaxAge))
+}
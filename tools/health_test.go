@@ -0,0 +1,99 @@
+package tools
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadiness(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	ok := runResult{run: 1, start: now.Add(-2 * time.Minute), end: now.Add(-time.Minute)}
+	failed := runResult{run: 2, start: now.Add(-time.Minute), end: now, exitStatus: 3, timedOut: true, signal: "SIGTERM"}
+
+	tests := []struct {
+		name    string
+		runs    []runResult
+		success []bool
+		breaker string
+		maxAge  time.Duration
+		reason  string
+	}{
+		{"no run yet", nil, nil, "", 0, "no run has finished yet"},
+		{"last run succeeded", []runResult{ok}, []bool{true}, "", 0, ""},
+		{"within max age", []runResult{ok}, []bool{true}, "", 5 * time.Minute, ""},
+		{"too old", []runResult{ok}, []bool{true}, "", 30 * time.Second, "last run finished 1m0s ago, longer than 30s"},
+		{"last run failed", []runResult{ok, failed}, []bool{true, false}, "", 0, "last run failed with exit status 3 (timed out, stopped with SIGTERM)"},
+		{"breaker half-open", []runResult{ok}, []bool{true}, "HALF-OPEN", 0, "circuit breaker is half-open"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newJobMetrics()
+			for i, res := range tt.runs {
+				m.observeRun(res, tt.success[i], 0)
+			}
+			m.setBreaker(tt.breaker)
+
+			status := m.readiness(now, tt.maxAge)
+			if status.Reason != tt.reason {
+				t.Errorf("reason = %q, want %q", status.Reason, tt.reason)
+			}
+			wantStatus := "ready"
+			if tt.reason != "" {
+				wantStatus = "not ready"
+			}
+			if status.Status != wantStatus {
+				t.Errorf("status = %q, want %q", status.Status, wantStatus)
+			}
+		})
+	}
+}
+
+func TestHealthEndpoints(t *testing.T) {
+	m := newJobMetrics()
+	m.setJob("3f2a11", "", []string{"./backup.sh"})
+
+	mux := http.NewServeMux()
+	mux.Handle("/healthz", healthHandler(m))
+	mux.Handle("/readyz", readyHandler(m, 0))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	get := func(path string) (int, HealthStatus) {
+		t.Helper()
+		resp, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatalf("GET %s error: %v", path, err)
+		}
+		defer resp.Body.Close()
+		if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+			t.Errorf("GET %s Content-Type = %q", path, ct)
+		}
+		var status HealthStatus
+		if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+			t.Fatalf("GET %s returned invalid JSON: %v", path, err)
+		}
+		return resp.StatusCode, status
+	}
+
+	if code, status := get("/healthz"); code != http.StatusOK || status.Status != "ok" || status.JobName != "backup.sh" {
+		t.Errorf("/healthz = %d %+v, want 200 ok", code, status)
+	}
+	if code, _ := get("/readyz"); code != http.StatusServiceUnavailable {
+		t.Errorf("/readyz before the first run = %d, want 503", code)
+	}
+
+	start := time.Now().Add(-time.Second)
+	m.observeRun(runResult{run: 1, start: start, end: start.Add(500 * time.Millisecond)}, true, 0)
+	code, status := get("/readyz")
+	if code != http.StatusOK || status.Status != "ready" {
+		t.Errorf("/readyz after a successful run = %d %+v, want 200 ready", code, status)
+	}
+	if status.LastRun == nil || status.LastRun.Run != 1 || status.LastRun.DurationMS != 500 || !status.LastRun.Success {
+		t.Errorf("unexpected last run %+v", status.LastRun)
+	}
+}
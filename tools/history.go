@@ -0,0 +1,280 @@
+package tools
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// HistoryConfig controls where run records are stored and how long they are kept
+type HistoryConfig struct {
+	Dir        string        // directory holding one <job-id>.jsonl file per job, empty disables the history
+	MaxRecords int           // records kept per job, 0 for no limit
+	MaxAge     time.Duration // records older than this are dropped, 0 for no limit
+}
+
+// RunRecord describes a single run of a job
+type RunRecord struct {
+	JobID       string    `json:"job_id"`
+	Run         int       `json:"run"`
+	Command     string    `json:"command"`
+	Start       time.Time `json:"start"`
+	End         time.Time `json:"end"`
+	DurationMS  int64     `json:"duration_ms"`
+	ExitCode    int       `json:"exit_code"`
+	Signal      string    `json:"signal,omitempty"`
+	TimedOut    bool      `json:"timed_out"`
+	Success     bool      `json:"success"`
+	Retries     int       `json:"retries"`
+	StdoutBytes *int64    `json:"stdout_bytes,omitempty"` // nil unless the output was captured
+	StderrBytes *int64    `json:"stderr_bytes,omitempty"`
+	Matched     string    `json:"matched,omitempty"`
+	MatchedLine string    `json:"matched_line,omitempty"`
+}
+
+// GetHistoryDir returns the default directory of the run history
+func GetHistoryDir() string {
+	homeDir := os.Getenv("HOME")
+	return filepath.Join(homeDir, ".run4ever", "history")
+}
+
+// historyStore appends the run records of a job to its history file
+type historyStore struct {
+	cfg    HistoryConfig
+	path   string
+	mu     sync.Mutex
+	count  int       // records in the file
+	oldest time.Time // start time of the first record in the file
+}
+
+func openHistoryStore(cfg HistoryConfig, jobID string) (*historyStore, error) {
+	if err := os.MkdirAll(cfg.Dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create history directory: %w", err)
+	}
+	sweepHistory(cfg)
+
+	h := &historyStore{cfg: cfg, path: filepath.Join(cfg.Dir, jobID+".jsonl")}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err := h.compact(); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// append adds a record, dropping old records once the retention limits are exceeded
+func (h *historyStore) append(rec RunRecord) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("failed to marshal run record: %w", err)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	f, err := os.OpenFile(h.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open history file: %w", err)
+	}
+	_, err = f.Write(append(data, '\n'))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write run record: %w", err)
+	}
+
+	if h.count == 0 {
+		h.oldest = rec.Start
+	}
+	h.count++
+	if h.overLimits() {
+		return h.compact()
+	}
+	return nil
+}
+
+// overLimits reports whether the file exceeds the retention limits by enough to
+// be rewritten, so that compaction does not happen on every run
+func (h *historyStore) overLimits() bool {
+	if max := h.cfg.MaxRecords; max > 0 && h.count > max+max/10 {
+		return true
+	}
+	if age := h.cfg.MaxAge; age > 0 && !h.oldest.IsZero() && time.Since(h.oldest) > age+age/10 {
+		return true
+	}
+	return false
+}
+
+// compact rewrites the history file with the records within the retention limits
+func (h *historyStore) compact() error {
+	records, err := readHistoryFile(h.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			h.count, h.oldest = 0, time.Time{}
+			return nil
+		}
+		return err
+	}
+
+	kept := applyRetention(records, h.cfg, time.Now())
+	if len(kept) != len(records) {
+		var buf bytes.Buffer
+		for _, rec := range kept {
+			data, err := json.Marshal(rec)
+			if err != nil {
+				return fmt.Errorf("failed to marshal run record: %w", err)
+			}
+			buf.Write(append(data, '\n'))
+		}
+		if err := atomicWriteFile(h.path, buf.Bytes(), 0644); err != nil {
+			return fmt.Errorf("failed to rewrite history file: %w", err)
+		}
+	}
+
+	h.count = len(kept)
+	h.oldest = time.Time{}
+	if len(kept) > 0 {
+		h.oldest = kept[0].Start
+	}
+	return nil
+}
+
+// applyRetention returns the records that are within the retention limits
+func applyRetention(records []RunRecord, cfg HistoryConfig, now time.Time) []RunRecord {
+	if cfg.MaxAge > 0 {
+		cutoff := now.Add(-cfg.MaxAge)
+		i := 0
+		for i < len(records) && records[i].Start.Before(cutoff) {
+			i++
+		}
+		records = records[i:]
+	}
+	if cfg.MaxRecords > 0 && len(records) > cfg.MaxRecords {
+		records = records[len(records)-cfg.MaxRecords:]
+	}
+	return records
+}
+
+// sweepHistory removes the history files of jobs that have not run within MaxAge
+func sweepHistory(cfg HistoryConfig) {
+	if cfg.MaxAge <= 0 {
+		return
+	}
+	files, _ := filepath.Glob(filepath.Join(cfg.Dir, "*.jsonl"))
+	for _, name := range files {
+		if info, err := os.Stat(name); err == nil && time.Since(info.ModTime()) > cfg.MaxAge {
+			os.Remove(name)
+		}
+	}
+}
+
+// readHistoryFile reads the records of a history file, skipping malformed lines
+func readHistoryFile(path string) ([]RunRecord, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var records []RunRecord
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*maxLineLength)
+	for scanner.Scan() {
+		var rec RunRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			continue // A partly written line, e.g. after a crash
+		}
+		records = append(records, rec)
+	}
+	return records, scanner.Err()
+}
+
+// historyJobIDs lists the IDs of the jobs that have a history file
+func historyJobIDs(dir string) []string {
+	files, _ := filepath.Glob(filepath.Join(dir, "*.jsonl"))
+	var ids []string
+	for _, name := range files {
+		ids = append(ids, strings.TrimSuffix(filepath.Base(name), ".jsonl"))
+	}
+	return ids
+}
+
+// ReadHistory returns the run records of a job, oldest first. The job is given
+// by name, ID or a unique ID prefix. A positive limit keeps only the latest runs.
+func ReadHistory(dir string, query string, limit int) ([]RunRecord, error) {
+	jobID, err := resolveJobIDWith(query, historyJobIDs(dir))
+	if err != nil {
+		return nil, err
+	}
+	records, err := readHistoryFile(filepath.Join(dir, jobID+".jsonl"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("no history stored for job %s", jobID)
+		}
+		return nil, err
+	}
+	if limit > 0 && len(records) > limit {
+		records = records[len(records)-limit:]
+	}
+	return records, nil
+}
+
+// PrintHistory writes run records as a table, or as a JSON array when asJSON is set
+func PrintHistory(w io.Writer, records []RunRecord, asJSON bool) error {
+	if asJSON {
+		if records == nil {
+			records = []RunRecord{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.SetEscapeHTML(false)
+		return enc.Encode(records)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "RUN\tSTARTED\tDURATION\tEXIT\tRESULT\tRETRIES\tSTDOUT\tSTDERR\tDETAILS")
+	for _, rec := range records {
+		result := "success"
+		if !rec.Success {
+			result = "failure"
+		}
+		var details []string
+		if rec.TimedOut {
+			details = append(details, "timed out")
+		}
+		if rec.Signal != "" {
+			details = append(details, rec.Signal)
+		}
+		if rec.Matched != "" {
+			details = append(details, fmt.Sprintf("%s-on-output: %s", rec.Matched, rec.MatchedLine))
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%d\t%s\t%d\t%s\t%s\t%s\n",
+			rec.Run,
+			rec.Start.Local().Format("2006-01-02 15:04:05"),
+			(time.Duration(rec.DurationMS) * time.Millisecond).String(),
+			rec.ExitCode,
+			result,
+			rec.Retries,
+			formatBytes(rec.StdoutBytes),
+			formatBytes(rec.StderrBytes),
+			strings.Join(details, ", "))
+	}
+	return tw.Flush()
+}
+
+// formatBytes shows a byte count of the history table, "-" when the output was not captured
+func formatBytes(n *int64) string {
+	if n == nil {
+		return "-"
+	}
+	return strconv.FormatInt(*n, 10)
+}
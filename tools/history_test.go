@@ -0,0 +1,180 @@
+package tools
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHistoryStoreRetention(t *testing.T) {
+	cfg := HistoryConfig{Dir: t.TempDir(), MaxRecords: 10}
+	h, err := openHistoryStore(cfg, "job")
+	if err != nil {
+		t.Fatalf("openHistoryStore() error: %v", err)
+	}
+	for run := 1; run <= 30; run++ {
+		if err := h.append(RunRecord{JobID: "job", Run: run, Start: time.Now()}); err != nil {
+			t.Fatalf("append() error: %v", err)
+		}
+	}
+
+	records, err := readHistoryFile(filepath.Join(cfg.Dir, "job.jsonl"))
+	if err != nil {
+		t.Fatalf("readHistoryFile() error: %v", err)
+	}
+	if len(records) < 10 || len(records) > 11 {
+		t.Errorf("got %d records, want 10 or 11", len(records))
+	}
+	if last := records[len(records)-1].Run; last != 30 {
+		t.Errorf("last record is run %d, want 30", last)
+	}
+
+	// Opening the store again compacts the file to the limit
+	if _, err := openHistoryStore(cfg, "job"); err != nil {
+		t.Fatalf("openHistoryStore() error: %v", err)
+	}
+	records, _ = readHistoryFile(filepath.Join(cfg.Dir, "job.jsonl"))
+	if len(records) != 10 || records[0].Run != 21 {
+		t.Errorf("after reopening got %d records starting at run %d, want 10 starting at 21", len(records), records[0].Run)
+	}
+}
+
+func TestApplyRetention(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	var records []RunRecord
+	for i := 5; i >= 1; i-- {
+		records = append(records, RunRecord{Run: 6 - i, Start: now.Add(-time.Duration(i) * time.Hour)})
+	}
+
+	kept := applyRetention(records, HistoryConfig{MaxAge: 150 * time.Minute}, now)
+	if len(kept) != 2 || kept[0].Run != 4 {
+		t.Errorf("MaxAge kept %+v, want runs 4 and 5", kept)
+	}
+	kept = applyRetention(records, HistoryConfig{MaxRecords: 3, MaxAge: 10 * time.Hour}, now)
+	if len(kept) != 3 || kept[0].Run != 3 {
+		t.Errorf("MaxRecords kept %+v, want runs 3 to 5", kept)
+	}
+}
+
+func TestSweepHistory(t *testing.T) {
+	dir := t.TempDir()
+	oldFile := filepath.Join(dir, "old.jsonl")
+	newFile := filepath.Join(dir, "new.jsonl")
+	os.WriteFile(oldFile, []byte("{}\n"), 0644)
+	os.WriteFile(newFile, []byte("{}\n"), 0644)
+	past := time.Now().Add(-48 * time.Hour)
+	os.Chtimes(oldFile, past, past)
+
+	sweepHistory(HistoryConfig{Dir: dir, MaxAge: 24 * time.Hour})
+	if _, err := os.Stat(oldFile); !os.IsNotExist(err) {
+		t.Error("history of a job that has not run within MaxAge was kept")
+	}
+	if _, err := os.Stat(newFile); err != nil {
+		t.Error("recent history was removed")
+	}
+}
+
+func TestRecordRun(t *testing.T) {
+	setupTestLogFile(t)
+	cfg := HistoryConfig{Dir: t.TempDir()}
+	h, err := openHistoryStore(cfg, "3f2a11")
+	if err != nil {
+		t.Fatalf("openHistoryStore() error: %v", err)
+	}
+	outputLog, err := openOutputLog(OutputLogConfig{Dir: t.TempDir()}, "3f2a11")
+	if err != nil {
+		t.Fatalf("openOutputLog() error: %v", err)
+	}
+	r := &runner{
+		args:       []string{"sh", "-c", "printf hello; printf oops >&2; exit 4", "--token=abc"},
+		opts:       RunOptions{JobID: "3f2a11"},
+		history:    h,
+		outputLog:  outputLog,
+		retryCount: 2,
+	}
+	r.recordRun(r.execute())
+	outputLog.close()
+
+	records, err := ReadHistory(cfg.Dir, "3f2", 0)
+	if err != nil {
+		t.Fatalf("ReadHistory() error: %v", err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("got %d records, want 1", len(records))
+	}
+	rec := records[0]
+	if rec.Run != 1 || rec.ExitCode != 4 || rec.Success || rec.Retries != 2 {
+		t.Errorf("unexpected record %+v", rec)
+	}
+	if rec.StdoutBytes == nil || rec.StderrBytes == nil || *rec.StdoutBytes != 5 || *rec.StderrBytes != 4 {
+		t.Errorf("byte counts = %s/%s, want 5/4", formatBytes(rec.StdoutBytes), formatBytes(rec.StderrBytes))
+	}
+	if rec.End.Before(rec.Start) || rec.DurationMS < 0 {
+		t.Errorf("invalid timing in %+v", rec)
+	}
+	if strings.Contains(rec.Command, "abc") {
+		t.Errorf("command %q was not masked", rec.Command)
+	}
+}
+
+func TestRecordRunWithoutCapture(t *testing.T) {
+	setupTestLogFile(t)
+	cfg := HistoryConfig{Dir: t.TempDir()}
+	h, err := openHistoryStore(cfg, "3f2a11")
+	if err != nil {
+		t.Fatalf("openHistoryStore() error: %v", err)
+	}
+	r := &runner{args: []string{"sh", "-c", "exit 0"}, opts: RunOptions{JobID: "3f2a11"}, history: h}
+	r.recordRun(r.execute())
+
+	records, err := ReadHistory(cfg.Dir, "3f2a11", 0)
+	if err != nil || len(records) != 1 {
+		t.Fatalf("ReadHistory() = %v, %v", records, err)
+	}
+	// History alone does not pipe the output just to count it
+	if records[0].StdoutBytes != nil || records[0].StderrBytes != nil {
+		t.Errorf("byte counts recorded without capturing the output: %+v", records[0])
+	}
+}
+
+func TestPrintHistory(t *testing.T) {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	records := []RunRecord{
+		{Run: 1, Start: start, DurationMS: 1500, Success: true},
+		{Run: 2, Start: start, DurationMS: 30000, ExitCode: 124, TimedOut: true, Signal: "SIGTERM", Retries: 1},
+	}
+
+	var table bytes.Buffer
+	if err := PrintHistory(&table, records, false); err != nil {
+		t.Fatalf("PrintHistory() error: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(table.String()), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], "RUN") {
+		t.Fatalf("unexpected table:\n%s", table.String())
+	}
+	if !strings.Contains(lines[1], "1.5s") || !strings.Contains(lines[1], "success") {
+		t.Errorf("unexpected first row %q", lines[1])
+	}
+	if !strings.Contains(lines[2], "failure") || !strings.Contains(lines[2], "timed out, SIGTERM") {
+		t.Errorf("unexpected second row %q", lines[2])
+	}
+
+	var out bytes.Buffer
+	if err := PrintHistory(&out, records, true); err != nil {
+		t.Fatalf("PrintHistory() error: %v", err)
+	}
+	var decoded []RunRecord
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil || len(decoded) != 2 || !decoded[1].TimedOut {
+		t.Errorf("JSON output did not round-trip: %v\n%s", err, out.String())
+	}
+
+	out.Reset()
+	PrintHistory(&out, nil, true)
+	if strings.TrimSpace(out.String()) != "[]" {
+		t.Errorf("empty JSON output = %q, want []", out.String())
+	}
+}
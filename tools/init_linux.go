@@ -0,0 +1,66 @@
+//go:build linux
+
+package tools
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+const prSetChildSubreaper = 36
+
+// startReaper makes run4ever adopt orphaned descendants and reaps them once they exit,
+// the way an init process does
+func startReaper(verbose bool) {
+	if os.Getpid() != 1 {
+		// Outside of PID 1 orphans are only reparented to us as a subreaper
+		syscall.RawSyscall(syscall.SYS_PRCTL, prSetChildSubreaper, 1, 0)
+	}
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGCHLD)
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		seen := map[int]bool{}
+		for {
+			select {
+			case <-sigs:
+			case <-ticker.C:
+			}
+			seen = reapOrphans(seen, verbose)
+		}
+	}()
+}
+
+// reapOrphans reaps zombie children that were already zombies in the previous scan.
+// Commands started by run4ever are reaped by their Wait almost immediately, so a
+// zombie that is still around is an orphaned descendant reparented to run4ever.
+func reapOrphans(seen map[int]bool, verbose bool) map[int]bool {
+	zombies := map[int]bool{}
+	for _, pid := range zombieChildren(os.Getpid()) {
+		if !seen[pid] || isTrackedPID(pid) {
+			zombies[pid] = true
+			continue
+		}
+		var ws syscall.WaitStatus
+		if reaped, err := syscall.Wait4(pid, &ws, syscall.WNOHANG, nil); err == nil && reaped == pid && verbose {
+			fmt.Fprintf(os.Stderr, "Reaped orphaned process %d\n", pid)
+		}
+	}
+	return zombies
+}
+
+// zombieChildren lists the zombie processes whose parent is ppid
+func zombieChildren(ppid int) []int {
+	var pids []int
+	for _, s := range allProcStats() {
+		if s.ppid == ppid && s.zombie() {
+			pids = append(pids, s.pid)
+		}
+	}
+	return pids
+}
@@ -0,0 +1,64 @@
+//go:build linux
+
+package tools
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestInitHelper(t *testing.T) {
+	if os.Getenv("RUN4EVER_TEST_INIT") != "1" {
+		t.Skip("helper process for init mode tests")
+	}
+	maxRetries, _ := strconv.Atoi(os.Getenv("RUN4EVER_TEST_MAX_RETRIES"))
+	RunInfinitely(1, 0, []string{"sh", "-c", os.Getenv("RUN4EVER_TEST_SCRIPT")}, false, maxRetries, "", "", "", "", "", false, "", "", "", "", "", 0,
+		RunOptions{InitMode: true})
+}
+
+func startInitHelper(t *testing.T, script string, maxRetries int) (*exec.Cmd, string) {
+	t.Helper()
+	dir := t.TempDir()
+	cmd := exec.Command(os.Args[0], "-test.run=^TestInitHelper$")
+	cmd.Env = append(os.Environ(),
+		"RUN4EVER_TEST_INIT=1",
+		"RUN4EVER_TEST_SCRIPT="+script,
+		"RUN4EVER_TEST_MAX_RETRIES="+strconv.Itoa(maxRetries),
+		"PID_FILE="+filepath.Join(dir, "pid"),
+	)
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("Failed to start helper: %v", err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+	})
+	return cmd, dir
+}
+
+func TestInitReapsOrphans(t *testing.T) {
+	// The shell exits right away and leaves a short lived orphan behind
+	_, dir := startInitHelper(t, `if [ ! -e "$PID_FILE" ]; then sleep 0.2 & echo $! > "$PID_FILE"; fi`, -1)
+	pid := readPIDFile(t, filepath.Join(dir, "pid"))
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, err := os.Stat(filepath.Join("/proc", strconv.Itoa(pid))); os.IsNotExist(err) {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	t.Errorf("Orphaned process %d was not reaped", pid)
+}
+
+func TestInitExitsWithCommandStatus(t *testing.T) {
+	cmd, _ := startInitHelper(t, "exit 5", 1)
+	err := cmd.Wait()
+	exitErr, ok := err.(*exec.ExitError)
+	if !ok || exitErr.ExitCode() != 5 {
+		t.Errorf("Expected exit status 5, got %v", err)
+	}
+}
@@ -0,0 +1,6 @@
+//go:build !linux
+
+package tools
+
+// startReaper is a no-op, zombie reaping is only needed for PID 1 on Linux
+func startReaper(verbose bool) {}
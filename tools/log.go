@@ -2,12 +2,13 @@ package tools
 
 import (
 	"bufio"
+	"bytes"
 	"crypto/rand"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"log"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strconv"
 	"strings"
@@ -15,15 +16,51 @@ import (
 	"time"
 )
 
+// stateVersion is the version of the state file format written by this build
+const stateVersion = 1
+
+// stateFile is the content of the state file
+type stateFile struct {
+	Version int        `json:"version"`
+	Jobs    []JobState `json:"jobs"`
+}
+
 // JobState represents a single job entry in the state file
 type JobState struct {
-	JobID     string
-	Name      string
-	PID       int
-	Command   string
-	Args      string
-	StartTime time.Time
-	IsStale   bool
+	JobID        string    `json:"job_id"`
+	Name         string    `json:"name,omitempty"`
+	Tags         []string  `json:"tags,omitempty"`
+	PID          int       `json:"pid"`
+	Command      string    `json:"command"`
+	Args         []string  `json:"args"` // masked
+	StartTime    time.Time `json:"start_time"`
+	IsStale      bool      `json:"stale,omitempty"`
+	NextRun      time.Time `json:"next_run"`          // zero when the job is not scheduled
+	Breaker      string    `json:"breaker,omitempty"` // OPEN or HALF-OPEN while the circuit breaker is not closed
+	DelaySeconds int       `json:"delay_seconds"`
+	RetryCount   int       `json:"retry_count"`
+	LastExitCode *int      `json:"last_exit_code,omitempty"` // nil until the first run finished
+	LastRun      time.Time `json:"last_run"`
+	Request      string    `json:"request,omitempty"` // control request pending for the supervisor: restart or kill
+
+	// Process groups of the running commands when the supervisor last took a
+	// control request, killed by run4ever kill when the supervisor does not exit
+	ProcessGroups []ProcessGroup `json:"process_groups,omitempty"`
+
+	// Identify the process behind PID, so that a reused PID is not taken for the job
+	ProcessStart uint64 `json:"process_start,omitempty"` // clock ticks since boot, Linux only
+	Executable   string `json:"executable,omitempty"`    // Linux only
+}
+
+// Status returns the status shown for the job in the state file and job lists
+func (j JobState) Status() string {
+	switch {
+	case j.Breaker != "":
+		return j.Breaker
+	case j.IsStale:
+		return "STALE"
+	}
+	return "RUNNING"
 }
 
 var (
@@ -42,23 +79,37 @@ func GenerateJobID() (string, error) {
 // GetStateFile returns the path to the state file
 func GetStateFile() string {
 	homeDir := os.Getenv("HOME")
-	return filepath.Join(homeDir, ".run4ever", "run4ever.state")
+	return filepath.Join(homeDir, ".run4ever", "state.json")
 }
 
-// WriteHeader writes the header line to the state file
-func WriteHeader(LogFile string) {
+// legacyStateFile is the name of the text state file used before state.json
+const legacyStateFile = "run4ever.state"
+
+// InitStateFile creates the state file unless it already has content. Jobs found
+// in a legacy text state file next to it are migrated, and the legacy file is
+// renamed to run4ever.state.migrated.
+func InitStateFile(stateFile string) {
 	stateMutex.Lock()
 	defer stateMutex.Unlock()
+	defer lockState(stateFile).unlock()
 
 	// Check if file exists and has content
-	if info, err := os.Stat(LogFile); err == nil && info.Size() > 0 {
-		return // Header already exists
+	if info, err := os.Stat(stateFile); err == nil && info.Size() > 0 {
+		return
 	}
 
-	header := "Time \t\t\t | Job-ID \t\t | PID \t\t | Command \t | Args \t\t | Status\n"
-	if err := atomicWriteFile(LogFile, []byte(header), 0644); err != nil {
+	var jobs []JobState
+	legacy := filepath.Join(filepath.Dir(stateFile), legacyStateFile)
+	data, err := os.ReadFile(legacy)
+	if err == nil && legacy != stateFile {
+		jobs = parseLegacyState(data)
+	}
+	if err := writeStateFile(stateFile, jobs); err != nil {
 		log.Fatal(err)
 	}
+	if data != nil && legacy != stateFile {
+		os.Rename(legacy, legacy+".migrated")
+	}
 }
 
 // Log adds a new job entry to the state file
@@ -78,13 +129,35 @@ func LogWithJobID(command string, args []string, pid int, jobID string, name str
 
 // LogWithFile adds a new job entry to a specific state file
 func LogWithFile(command string, args []string, pid int, jobID string, name string, logFile string) {
+	if err := RegisterJobWithFile(command, args, pid, jobID, name, nil, logFile); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// RegisterJob adds a new job entry with a name and tags to the state file. The
+// name must not be used by another running job.
+func RegisterJob(command string, args []string, pid int, jobID string, name string, tags []string) error {
+	LogFile := GetStateFile()
+	return RegisterJobWithFile(command, args, pid, jobID, name, tags, LogFile)
+}
+
+// RegisterJobWithFile adds a new job entry with a name and tags to a specific state file
+func RegisterJobWithFile(command string, args []string, pid int, jobID string, name string, tags []string, logFile string) error {
 	stateMutex.Lock()
 	defer stateMutex.Unlock()
+	defer lockState(logFile).unlock()
 
 	// Read existing state
 	jobs, err := readStateFile(logFile)
 	if err != nil && !os.IsNotExist(err) {
-		log.Fatal(err)
+		return err
+	}
+	if name != "" {
+		for _, job := range jobs {
+			if job.Name == name && !job.IsStale {
+				return fmt.Errorf("job name %q is already used by running job %s", name, job.JobID)
+			}
+		}
 	}
 
 	// Add new job
@@ -94,18 +167,19 @@ func LogWithFile(command string, args []string, pid int, jobID string, name stri
 	newJob := JobState{
 		JobID:     jobID,
 		Name:      name,
+		Tags:      tags,
 		PID:       pid,
 		Command:   command,
-		Args:      strings.Join(maskedArgs, " "),
+		Args:      maskedArgs,
 		StartTime: t,
 		IsStale:   false,
 	}
+	newJob.ProcessStart, _ = processStartTime(pid)
+	newJob.Executable, _ = processExecutable(pid)
 	jobs = append(jobs, newJob)
 
 	// Write state atomically
-	if err := writeStateFile(logFile, jobs); err != nil {
-		log.Fatal(err)
-	}
+	return writeStateFile(logFile, jobs)
 }
 
 // DeleteLog removes a job entry by job ID
@@ -118,6 +192,7 @@ func DeleteLog(jobID string) {
 func DeleteLogWithFile(jobID string, logFile string) {
 	stateMutex.Lock()
 	defer stateMutex.Unlock()
+	defer lockState(logFile).unlock()
 
 	jobs, err := readStateFile(logFile)
 	if err != nil {
@@ -146,6 +221,7 @@ func DeleteLogByPID(pid int) {
 	LogFile := GetStateFile()
 	stateMutex.Lock()
 	defer stateMutex.Unlock()
+	defer lockState(LogFile).unlock()
 
 	jobs, err := readStateFile(LogFile)
 	if err != nil {
@@ -169,17 +245,159 @@ func DeleteLogByPID(pid int) {
 	}
 }
 
-// readStateFile reads the state file and returns all job entries
+// UpdateNextRun records the next scheduled run time of a job
+func UpdateNextRun(jobID string, next time.Time) error {
+	LogFile := GetStateFile()
+	return UpdateNextRunWithFile(jobID, next, LogFile)
+}
+
+// UpdateNextRunWithFile records the next scheduled run time of a job in a specific state file
+func UpdateNextRunWithFile(jobID string, next time.Time, logFile string) error {
+	return updateJob(jobID, logFile, func(job *JobState) {
+		job.NextRun = next
+	})
+}
+
+// UpdateBreaker records the circuit breaker state of a job, empty when closed
+func UpdateBreaker(jobID string, state string) error {
+	LogFile := GetStateFile()
+	return UpdateBreakerWithFile(jobID, state, LogFile)
+}
+
+// UpdateBreakerWithFile records the circuit breaker state of a job in a specific state file
+func UpdateBreakerWithFile(jobID string, state string, logFile string) error {
+	return updateJob(jobID, logFile, func(job *JobState) {
+		job.Breaker = state
+	})
+}
+
+// UpdateDelay records the delay between the runs of a job
+func UpdateDelay(jobID string, delaySeconds int) error {
+	LogFile := GetStateFile()
+	return UpdateDelayWithFile(jobID, delaySeconds, LogFile)
+}
+
+// UpdateDelayWithFile records the delay between the runs of a job in a specific state file
+func UpdateDelayWithFile(jobID string, delaySeconds int, logFile string) error {
+	return updateJob(jobID, logFile, func(job *JobState) {
+		job.DelaySeconds = delaySeconds
+	})
+}
+
+// UpdateLastRun records the exit code and end time of the last run of a job and
+// its retry count
+func UpdateLastRun(jobID string, exitCode int, end time.Time, retryCount int) error {
+	LogFile := GetStateFile()
+	return UpdateLastRunWithFile(jobID, exitCode, end, retryCount, LogFile)
+}
+
+// UpdateLastRunWithFile records the last run of a job in a specific state file
+func UpdateLastRunWithFile(jobID string, exitCode int, end time.Time, retryCount int, logFile string) error {
+	return updateJob(jobID, logFile, func(job *JobState) {
+		job.LastExitCode = &exitCode
+		job.LastRun = end
+		job.RetryCount = retryCount
+	})
+}
+
+// updateJob applies a change to the job entry with the given job ID
+func updateJob(jobID string, logFile string, update func(job *JobState)) error {
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+	l, err := lockFile(logFile)
+	if err != nil {
+		return err
+	}
+	defer l.unlock()
+
+	jobs, err := readStateFile(logFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	for i := range jobs {
+		if jobs[i].JobID == jobID {
+			update(&jobs[i])
+		}
+	}
+
+	// Write state atomically
+	return writeStateFile(logFile, jobs)
+}
+
+// formatNextRun formats a next run time for the state file, "-" when unscheduled
+func formatNextRun(next time.Time) string {
+	if next.IsZero() {
+		return "-"
+	}
+	return next.Local().Format("2006-01-02 15:04:05")
+}
+
+// lockState takes the lock that serializes changes to the state file across
+// run4ever processes. stateMutex must be held as well.
+func lockState(logFile string) *fileLock {
+	l, err := lockFile(logFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return l
+}
+
+// readStateFile reads the state file and returns all job entries. A state file
+// still in the legacy text format is read as well, and is rewritten as JSON by
+// the next change.
 func readStateFile(logFile string) ([]JobState, error) {
+	data, err := os.ReadFile(logFile)
+	if err != nil {
+		return nil, err
+	}
+
 	var jobs []JobState
+	trimmed := bytes.TrimSpace(data)
+	switch {
+	case len(trimmed) == 0:
+	case trimmed[0] == '{':
+		var state stateFile
+		if err := json.Unmarshal(trimmed, &state); err != nil {
+			return nil, fmt.Errorf("failed to parse state file %s: %w", logFile, err)
+		}
+		if state.Version > stateVersion {
+			return nil, fmt.Errorf("state file %s has version %d, this run4ever supports up to version %d", logFile, state.Version, stateVersion)
+		}
+		jobs = state.Jobs
+	default:
+		jobs = parseLegacyState(data)
+	}
 
-	f, err := os.Open(logFile)
+	// Check if processes are actually running
+	for i := range jobs {
+		if !jobs[i].IsStale && !isJobRunning(jobs[i]) {
+			jobs[i].IsStale = true
+		}
+	}
+	return jobs, nil
+}
+
+// writeStateFile writes all job entries to the state file atomically
+func writeStateFile(logFile string, jobs []JobState) error {
+	if jobs == nil {
+		jobs = []JobState{}
+	}
+	data, err := json.MarshalIndent(stateFile{Version: stateVersion, Jobs: jobs}, "", "  ")
 	if err != nil {
-		return jobs, err
+		return fmt.Errorf("failed to marshal state: %w", err)
 	}
-	defer f.Close()
+	return atomicWriteFile(logFile, append(data, '\n'), 0644)
+}
 
-	scanner := bufio.NewScanner(f)
+// parseLegacyState parses the pipe-delimited text state file written before the
+// JSON format. Arguments are split on spaces, and unparsable start times are left zero.
+func parseLegacyState(data []byte) []JobState {
+	var jobs []JobState
+	scanner := bufio.NewScanner(bytes.NewReader(data))
 	lineNum := 0
 	for scanner.Scan() {
 		lineNum++
@@ -188,67 +406,41 @@ func readStateFile(logFile string) ([]JobState, error) {
 			continue // Skip header and empty lines
 		}
 
-		// Parse line: Time | Job-ID | PID | Command | Args | Status
+		// Parse line: Time | Job-ID | PID | Command | Args | Status [| Next-Run]
 		parts := strings.Split(line, "|")
 		if len(parts) < 6 {
 			continue // Skip malformed lines
 		}
 
-		timeStr := strings.TrimSpace(parts[0])
-		jobID := strings.TrimSpace(parts[1])
-		pidStr := strings.TrimSpace(parts[2])
-		command := strings.TrimSpace(parts[3])
-		args := strings.TrimSpace(parts[4])
-		status := strings.TrimSpace(parts[5])
-
-		pid, err := strconv.Atoi(pidStr)
+		pid, err := strconv.Atoi(strings.TrimSpace(parts[2]))
 		if err != nil {
 			continue
 		}
+		startTime, _ := time.ParseInLocation("2006-01-02 15:04:05", strings.TrimSpace(parts[0]), time.Local)
 
-		startTime, err := time.Parse("2006-01-02 15:04:05", timeStr)
-		if err != nil {
-			startTime = time.Now() // Fallback to current time
+		var nextRun time.Time
+		if len(parts) > 6 {
+			nextRun, _ = time.ParseInLocation("2006-01-02 15:04:05", strings.TrimSpace(parts[6]), time.Local)
 		}
 
-		isStale := status == "STALE"
-
-		// Check if process is actually running
-		if !isStale && !isProcessRunning(pid) {
-			isStale = true
+		status := strings.TrimSpace(parts[5])
+		var breaker string
+		if status == "OPEN" || status == "HALF-OPEN" {
+			breaker = status
 		}
 
 		jobs = append(jobs, JobState{
-			JobID:     jobID,
+			JobID:     strings.TrimSpace(parts[1]),
 			PID:       pid,
-			Command:   command,
-			Args:      args,
+			Command:   strings.TrimSpace(parts[3]),
+			Args:      strings.Fields(parts[4]),
 			StartTime: startTime,
-			IsStale:   isStale,
+			IsStale:   status == "STALE",
+			NextRun:   nextRun,
+			Breaker:   breaker,
 		})
 	}
-
-	return jobs, scanner.Err()
-}
-
-// writeStateFile writes all job entries to the state file atomically
-func writeStateFile(logFile string, jobs []JobState) error {
-	var lines []string
-	lines = append(lines, "Time \t\t\t | Job-ID \t\t | PID \t\t | Command \t | Args \t\t | Status\n")
-
-	for _, job := range jobs {
-		tf := job.StartTime.Format("2006-01-02 15:04:05")
-		status := "RUNNING"
-		if job.IsStale {
-			status = "STALE"
-		}
-		line := fmt.Sprintf("%s \t | %s \t | %d \t | %s \t\t | %s \t\t | %s\n",
-			tf, job.JobID, job.PID, job.Command, job.Args, status)
-		lines = append(lines, line)
-	}
-
-	content := []byte(strings.Join(lines, ""))
-	return atomicWriteFile(logFile, content, 0644)
+	return jobs
 }
 
 // atomicWriteFile writes content to a file atomically using a temp file and rename
@@ -289,18 +481,28 @@ func atomicWriteFile(filename string, content []byte, perm os.FileMode) error {
 	return nil
 }
 
-// isProcessRunning checks if a process with the given PID is running
-func isProcessRunning(pid int) bool {
-	// Use ps command to check if process exists
-	cmd := exec.Command("ps", "-p", strconv.Itoa(pid))
-	if err := cmd.Run(); err != nil {
+// isJobRunning reports whether the process of a job entry is still running. The
+// process must also have the recorded start time and executable, so that an
+// unrelated process that took over the PID does not keep the job alive.
+func isJobRunning(job JobState) bool {
+	if !processExists(job.PID) || processZombie(job.PID) {
 		return false
 	}
+	if job.ProcessStart != 0 {
+		if start, err := processStartTime(job.PID); err == nil && start != job.ProcessStart {
+			return false
+		}
+	}
+	if job.Executable != "" {
+		if exe, err := processExecutable(job.PID); err == nil && exe != job.Executable {
+			return false
+		}
+	}
 	return true
 }
 
-// Ps displays all running jobs in a continuous loop
-func Ps() {
+// Ps displays all running jobs in a continuous loop, without stale jobs when hideStale is set
+func Ps(hideStale bool) {
 	LogFile := GetStateFile()
 
 	for {
@@ -311,20 +513,19 @@ func Ps() {
 		if err != nil && !os.IsNotExist(err) {
 			log.Fatal(err)
 		}
+		if hideStale {
+			jobs = withoutStale(jobs)
+		}
 
 		// Print header
-		fmt.Println("Time \t\t\t | Job-ID \t\t | PID \t\t | Command \t | Args \t\t | Status")
+		fmt.Println("Time \t\t\t | Job-ID \t\t | PID \t\t | Command \t | Args \t\t | Status \t | Next-Run")
 		fmt.Println(strings.Repeat("-", 120))
 
 		// Print jobs
 		for _, job := range jobs {
-			status := "RUNNING"
-			if job.IsStale {
-				status = "STALE"
-			}
 			tf := job.StartTime.Format("2006-01-02 15:04:05")
-			fmt.Printf("%s \t | %s \t | %d \t | %s \t\t | %s \t\t | %s\n",
-				tf, job.JobID, job.PID, job.Command, job.Args, status)
+			fmt.Printf("%s \t | %s \t | %d \t | %s \t\t | %s \t\t | %s \t | %s\n",
+				tf, job.JobID, job.PID, job.Command, strings.Join(job.Args, " "), job.Status(), formatNextRun(job.NextRun))
 		}
 
 		time.Sleep(3 * time.Second)
@@ -332,8 +533,8 @@ func Ps() {
 	}
 }
 
-// ListJobs displays all running jobs once and exits
-func ListJobs() {
+// ListJobs displays all running jobs once and exits, without stale jobs when hideStale is set
+func ListJobs(hideStale bool) {
 	LogFile := GetStateFile()
 
 	stateMutex.Lock()
@@ -343,6 +544,9 @@ func ListJobs() {
 	if err != nil && !os.IsNotExist(err) {
 		log.Fatal(err)
 	}
+	if hideStale {
+		jobs = withoutStale(jobs)
+	}
 
 	if len(jobs) == 0 {
 		fmt.Println("No running jobs found.")
@@ -350,17 +554,74 @@ func ListJobs() {
 	}
 
 	// Print header
-	fmt.Println("Time \t\t\t | Job-ID \t\t | PID \t\t | Command \t | Args \t\t | Status")
+	fmt.Println("Time \t\t\t | Job-ID \t\t | PID \t\t | Command \t | Args \t\t | Status \t | Next-Run")
 	fmt.Println(strings.Repeat("-", 120))
 
 	// Print jobs
 	for _, job := range jobs {
-		status := "RUNNING"
-		if job.IsStale {
-			status = "STALE"
-		}
 		tf := job.StartTime.Format("2006-01-02 15:04:05")
-		fmt.Printf("%s \t | %s \t | %d \t | %s \t\t | %s \t\t | %s\n",
-			tf, job.JobID, job.PID, job.Command, job.Args, status)
+		fmt.Printf("%s \t | %s \t | %d \t | %s \t\t | %s \t\t | %s \t | %s\n",
+			tf, job.JobID, job.PID, job.Command, strings.Join(job.Args, " "), job.Status(), formatNextRun(job.NextRun))
+	}
+}
+
+// withoutStale drops the jobs whose process is gone, the same jobs prune removes,
+// including jobs stopped by an open circuit breaker
+func withoutStale(jobs []JobState) []JobState {
+	var live []JobState
+	for _, job := range jobs {
+		if !job.IsStale {
+			live = append(live, job)
+		}
+	}
+	return live
+}
+
+// ResolveJobID returns the ID of the job in the state file matching query, which
+// can be a job name, a full job ID or a unique prefix of one
+func ResolveJobID(query string) (string, error) {
+	return resolveJobIDWith(query, nil)
+}
+
+// resolveJobIDWith resolves query against the jobs in the state file and the
+// IDs of jobs that only have stored data left, such as output logs or history
+func resolveJobIDWith(query string, stored []string) (string, error) {
+	stateMutex.Lock()
+	jobs, err := readStateFile(GetStateFile())
+	stateMutex.Unlock()
+
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+	for _, id := range stored {
+		jobs = append(jobs, JobState{JobID: id})
+	}
+	return matchJobID(query, jobs)
+}
+
+// matchJobID finds the job matching query by name, full ID or unique ID prefix
+func matchJobID(query string, jobs []JobState) (string, error) {
+	if query == "" {
+		return "", fmt.Errorf("no job ID given")
+	}
+
+	var matches []string
+	seen := map[string]bool{}
+	for _, job := range jobs {
+		if job.JobID == query || (job.Name != "" && job.Name == query) {
+			return job.JobID, nil
+		}
+		if strings.HasPrefix(job.JobID, query) && !seen[job.JobID] {
+			seen[job.JobID] = true
+			matches = append(matches, job.JobID)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("no job matches %q", query)
+	case 1:
+		return matches[0], nil
 	}
+	return "", fmt.Errorf("job ID prefix %q is ambiguous, it matches %s", query, strings.Join(matches, ", "))
 }
@@ -1,12 +1,15 @@
 package tools
 
 import (
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 )
 
 func setupTestLogFile(t *testing.T) string {
@@ -23,25 +26,75 @@ func setupTestLogFile(t *testing.T) string {
 	return logFile
 }
 
-func TestWriteHeader(t *testing.T) {
+func TestInitStateFile(t *testing.T) {
 	logFile := setupTestLogFile(t)
 
-	WriteHeader(logFile)
+	InitStateFile(logFile)
 
 	content, err := ioutil.ReadFile(logFile)
 	if err != nil {
 		t.Fatalf("Failed to read log file: %v", err)
 	}
 
-	expected := "Time \t\t\t | Job-ID \t\t | PID \t\t | Command \t | Args \t\t | Status\n"
-	if string(content) != expected {
-		t.Errorf("WriteHeader failed. Expected: %q, Got: %q", expected, string(content))
+	var state stateFile
+	if err := json.Unmarshal(content, &state); err != nil {
+		t.Fatalf("State file is not valid JSON: %v\n%s", err, content)
+	}
+	if state.Version != stateVersion || state.Jobs == nil || len(state.Jobs) != 0 {
+		t.Errorf("InitStateFile failed. Got: %s", content)
+	}
+}
+
+func TestInitStateFileMigratesLegacyState(t *testing.T) {
+	dir := t.TempDir()
+	legacy := "Time \t\t\t | Job-ID \t\t | PID \t\t | Command \t | Args \t\t | Status \t | Next-Run\n" +
+		fmt.Sprintf("2024-05-01 12:00:00 \t | aaa111 \t | %d \t | sleep \t\t | 60 \t\t | RUNNING \t | 2030-01-02 03:04:05\n", os.Getpid()) +
+		"2024-05-01 12:30:00 \t | bbb222 \t | 12345 \t | ./backup.sh \t\t | --all --quiet \t\t | OPEN \t | -\n" +
+		"garbage line\n"
+	os.WriteFile(filepath.Join(dir, "run4ever.state"), []byte(legacy), 0644)
+
+	stateFile := filepath.Join(dir, "state.json")
+	InitStateFile(stateFile)
+
+	jobs, err := readStateFile(stateFile)
+	if err != nil {
+		t.Fatalf("Failed to read state file: %v", err)
+	}
+	if len(jobs) != 2 {
+		t.Fatalf("Expected two migrated jobs, got %+v", jobs)
+	}
+	first, second := jobs[0], jobs[1]
+	if first.JobID != "aaa111" || first.PID != os.Getpid() || first.Command != "sleep" || !reflect.DeepEqual(first.Args, []string{"60"}) || first.IsStale {
+		t.Errorf("Unexpected first job %+v", first)
+	}
+	wantStart := time.Date(2024, 5, 1, 12, 0, 0, 0, time.Local)
+	wantNext := time.Date(2030, 1, 2, 3, 4, 5, 0, time.Local)
+	if !first.StartTime.Equal(wantStart) || !first.NextRun.Equal(wantNext) {
+		t.Errorf("Start and next run times were not migrated: %v, %v", first.StartTime, first.NextRun)
+	}
+	if second.Breaker != "OPEN" || !reflect.DeepEqual(second.Args, []string{"--all", "--quiet"}) || !second.NextRun.IsZero() {
+		t.Errorf("Unexpected second job %+v", second)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "run4ever.state")); !os.IsNotExist(err) {
+		t.Error("Legacy state file should be renamed after the migration")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "run4ever.state.migrated")); err != nil {
+		t.Errorf("Legacy state file should be kept as run4ever.state.migrated: %v", err)
+	}
+}
+
+func TestReadStateFileVersion(t *testing.T) {
+	logFile := setupTestLogFile(t)
+	os.WriteFile(logFile, []byte(`{"version": 99, "jobs": []}`), 0644)
+	if _, err := readStateFile(logFile); err == nil || !strings.Contains(err.Error(), "version 99") {
+		t.Errorf("Expected an error for a newer state file version, got %v", err)
 	}
 }
 
 func TestLog(t *testing.T) {
 	logFile := setupTestLogFile(t)
-	WriteHeader(logFile)
+	InitStateFile(logFile)
 
 	command := "test_command"
 	args := []string{"arg1", "arg2"}
@@ -51,36 +104,73 @@ func TestLog(t *testing.T) {
 
 	LogWithFile(command, args, pid, jobID, name, logFile)
 
-	content, err := ioutil.ReadFile(logFile)
+	jobs, err := readStateFile(logFile)
 	if err != nil {
-		t.Fatalf("Failed to read log file: %v", err)
+		t.Fatalf("Failed to read state file: %v", err)
+	}
+	if len(jobs) != 1 {
+		t.Fatalf("Expected one job, got %d", len(jobs))
 	}
 
-	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
-	if len(lines) < 2 {
-		t.Fatal("Expected at least header and one log entry")
+	job := jobs[0]
+	if job.PID != pid {
+		t.Errorf("Job should have PID %d, got %d", pid, job.PID)
+	}
+	if job.Command != command {
+		t.Errorf("Job should have command %s, got %s", command, job.Command)
+	}
+	if job.JobID != jobID || job.Name != name {
+		t.Errorf("Job should have ID %s and name %s, got %s and %s", jobID, name, job.JobID, job.Name)
+	}
+	if !reflect.DeepEqual(job.Args, args) {
+		t.Errorf("Job should have arguments %q, got %q", args, job.Args)
+	}
+	if time.Since(job.StartTime) > time.Minute {
+		t.Errorf("Job start time %v was not kept", job.StartTime)
 	}
+}
+
+func TestLogKeepsSpecialArguments(t *testing.T) {
+	logFile := setupTestLogFile(t)
+	InitStateFile(logFile)
+
+	args := []string{"-c", "grep -E 'a|b' file | wc -l", "tab\there"}
+	LogWithFile("sh", args, os.Getpid(), "job-1", "", logFile)
 
-	logLine := lines[1]
-	if !strings.Contains(logLine, fmt.Sprintf("%d", pid)) {
-		t.Errorf("Log entry should contain PID %d", pid)
+	jobs, err := readStateFile(logFile)
+	if err != nil {
+		t.Fatalf("Failed to read state file: %v", err)
 	}
-	if !strings.Contains(logLine, command) {
-		t.Errorf("Log entry should contain command %s", command)
+	if len(jobs) != 1 || !reflect.DeepEqual(jobs[0].Args, args) {
+		t.Errorf("Arguments did not round-trip: %+v", jobs)
 	}
-	if !strings.Contains(logLine, jobID) {
-		t.Errorf("Log entry should contain job ID %s", jobID)
+}
+
+func TestUpdateLastRun(t *testing.T) {
+	logFile := setupTestLogFile(t)
+	InitStateFile(logFile)
+
+	jobID := "test-job-id-12345"
+	LogWithFile("test_command", nil, os.Getpid(), jobID, "", logFile)
+	UpdateDelayWithFile(jobID, 30, logFile)
+
+	jobs, _ := readStateFile(logFile)
+	if jobs[0].DelaySeconds != 30 || jobs[0].LastExitCode != nil {
+		t.Fatalf("Unexpected job before the first run %+v", jobs[0])
 	}
-	for _, arg := range args {
-		if !strings.Contains(logLine, arg) {
-			t.Errorf("Log entry should contain argument %s", arg)
-		}
+
+	end := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	UpdateLastRunWithFile(jobID, 3, end, 2, logFile)
+	jobs, _ = readStateFile(logFile)
+	job := jobs[0]
+	if job.LastExitCode == nil || *job.LastExitCode != 3 || !job.LastRun.Equal(end) || job.RetryCount != 2 || job.DelaySeconds != 30 {
+		t.Errorf("Unexpected job after the first run %+v", job)
 	}
 }
 
 func TestDeleteLog(t *testing.T) {
 	logFile := setupTestLogFile(t)
-	WriteHeader(logFile)
+	InitStateFile(logFile)
 
 	command := "test_command"
 	args := []string{"arg1", "arg2"}
@@ -115,7 +205,7 @@ func TestDeleteLog(t *testing.T) {
 
 func TestLogWithPasswordMasking(t *testing.T) {
 	logFile := setupTestLogFile(t)
-	WriteHeader(logFile)
+	InitStateFile(logFile)
 
 	command := "ssh"
 	args := []string{"-password", "secret123", "user@host"}
@@ -138,3 +228,56 @@ func TestLogWithPasswordMasking(t *testing.T) {
 		t.Error("Masked password should appear as ******")
 	}
 }
+
+func TestUpdateNextRun(t *testing.T) {
+	logFile := setupTestLogFile(t)
+	InitStateFile(logFile)
+
+	jobID := "test-job-id-12345"
+	LogWithFile("test_command", []string{"arg1"}, os.Getpid(), jobID, "test-job", logFile)
+
+	next := time.Date(2030, time.January, 2, 3, 4, 5, 0, time.Local)
+	UpdateNextRunWithFile(jobID, next, logFile)
+
+	jobs, err := readStateFile(logFile)
+	if err != nil {
+		t.Fatalf("Failed to read state file: %v", err)
+	}
+	if len(jobs) != 1 {
+		t.Fatalf("Expected one job, got %d", len(jobs))
+	}
+	if !jobs[0].NextRun.Equal(next) {
+		t.Errorf("NextRun = %v, want %v", jobs[0].NextRun, next)
+	}
+}
+
+func TestUpdateBreaker(t *testing.T) {
+	logFile := setupTestLogFile(t)
+	InitStateFile(logFile)
+
+	jobID := "test-job-id-12345"
+	LogWithFile("test_command", []string{"arg1"}, os.Getpid(), jobID, "test-job", logFile)
+	UpdateBreakerWithFile(jobID, "OPEN", logFile)
+
+	content, err := ioutil.ReadFile(logFile)
+	if err != nil {
+		t.Fatalf("Failed to read log file: %v", err)
+	}
+	if !strings.Contains(string(content), "OPEN") {
+		t.Error("State file should show the OPEN breaker status")
+	}
+
+	jobs, err := readStateFile(logFile)
+	if err != nil {
+		t.Fatalf("Failed to read state file: %v", err)
+	}
+	if len(jobs) != 1 || jobs[0].Status() != "OPEN" {
+		t.Fatalf("Expected job with OPEN status, got %+v", jobs)
+	}
+
+	UpdateBreakerWithFile(jobID, "", logFile)
+	jobs, _ = readStateFile(logFile)
+	if jobs[0].Status() != "RUNNING" {
+		t.Errorf("Expected RUNNING status after closing the breaker, got %s", jobs[0].Status())
+	}
+}
@@ -0,0 +1,276 @@
+package tools
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// LogsOptions selects the stored output shown by ShowLogs
+type LogsOptions struct {
+	Dir        string        // base directory of the output logs
+	Follow     bool          // keep printing new output until the job ends
+	Tail       int           // number of lines to show from the end, negative for all
+	Run        int           // only show this run, 0 for all runs
+	Since      time.Duration // only show output newer than this, 0 for all
+	StderrOnly bool          // only show lines written to stderr
+}
+
+// followInterval is how often a followed log is checked for new output
+const followInterval = 500 * time.Millisecond
+
+// jobCheckInterval is how often following checks whether the job is still running
+const jobCheckInterval = 2 * time.Second
+
+// ShowLogs prints the stored output of a job. The job is given by name, ID or a
+// unique ID prefix. Stdout lines and run separators are written to stdout and
+// stderr lines to stderr.
+func ShowLogs(query string, opts LogsOptions, stdout io.Writer, stderr io.Writer) error {
+	jobID, err := resolveLogJob(query, opts.Dir)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Join(opts.Dir, jobID)
+	if _, err := os.Stat(dir); err != nil {
+		return fmt.Errorf("no output stored for job %s", jobID)
+	}
+
+	v := &logViewer{opts: opts, stdout: stdout, stderr: stderr}
+	if opts.Since > 0 {
+		v.since = time.Now().Add(-opts.Since)
+	}
+
+	for _, name := range rotatedLogFiles(dir) {
+		if err := v.readFile(name); err != nil {
+			return err
+		}
+	}
+
+	current := filepath.Join(dir, outputLogName)
+	f := &followedFile{path: current}
+	if err := f.open(); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	defer f.close()
+	f.readLines(v.add)
+	if !opts.Follow {
+		f.flush(v.add)
+	}
+	v.flushTail()
+
+	if !opts.Follow {
+		return nil
+	}
+	return v.follow(f, jobID)
+}
+
+// logViewer filters output log entries and prints them
+type logViewer struct {
+	opts   LogsOptions
+	since  time.Time
+	stdout io.Writer
+	stderr io.Writer
+	tail   []outputEntry
+	live   bool // entries are printed right away instead of kept for --tail
+}
+
+// add handles a raw line of an output log
+func (v *logViewer) add(line string) {
+	entry, ok := parseOutputLine(line)
+	if !ok || !v.matches(entry) {
+		return
+	}
+	if v.live || v.opts.Tail < 0 {
+		v.print(entry)
+		return
+	}
+	v.tail = append(v.tail, entry)
+	if len(v.tail) > v.opts.Tail {
+		v.tail = v.tail[1:]
+	}
+}
+
+func (v *logViewer) matches(entry outputEntry) bool {
+	if v.opts.Run > 0 && entry.run != v.opts.Run {
+		return false
+	}
+	if v.opts.StderrOnly && entry.stream != "stderr" {
+		return false
+	}
+	return v.since.IsZero() || !entry.time.Before(v.since)
+}
+
+func (v *logViewer) print(entry outputEntry) {
+	if entry.stream == "stderr" {
+		fmt.Fprintln(v.stderr, entry.text)
+		return
+	}
+	fmt.Fprintln(v.stdout, entry.text)
+}
+
+// flushTail prints the lines kept for --tail and switches to printing lines as they come
+func (v *logViewer) flushTail() {
+	for _, entry := range v.tail {
+		v.print(entry)
+	}
+	v.tail = nil
+	v.live = true
+}
+
+// readFile reads a whole rotated log, compressed or not
+func (v *logViewer) readFile(name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			// Pruned by the running job in the meantime
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if strings.HasSuffix(name, ".gz") {
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		defer zr.Close()
+		r = zr
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 2*maxLineLength)
+	for scanner.Scan() {
+		v.add(scanner.Text())
+	}
+	return scanner.Err()
+}
+
+// follow prints new output as it is written, across rotations, until the job ends
+func (v *logViewer) follow(f *followedFile, jobID string) error {
+	lastCheck := time.Now()
+	for {
+		time.Sleep(followInterval)
+		f.readLines(v.add)
+		if err := f.reopenIfRotated(v.add); err != nil {
+			return err
+		}
+
+		if time.Since(lastCheck) >= jobCheckInterval {
+			lastCheck = time.Now()
+			if !jobActive(jobID) {
+				f.readLines(v.add)
+				f.flush(v.add)
+				return nil
+			}
+		}
+	}
+}
+
+// followedFile reads complete lines from a file that may still be growing
+type followedFile struct {
+	path    string
+	file    *os.File
+	reader  *bufio.Reader
+	partial string
+}
+
+func (f *followedFile) open() error {
+	file, err := os.Open(f.path)
+	if err != nil {
+		return err
+	}
+	f.file = file
+	f.reader = bufio.NewReader(file)
+	f.partial = ""
+	return nil
+}
+
+func (f *followedFile) close() {
+	if f.file != nil {
+		f.file.Close()
+		f.file = nil
+	}
+}
+
+// readLines passes every complete line written since the last call to fn
+func (f *followedFile) readLines(fn func(string)) {
+	if f.file == nil {
+		return
+	}
+	for {
+		s, err := f.reader.ReadString('\n')
+		f.partial += s
+		if err != nil {
+			return
+		}
+		fn(f.partial)
+		f.partial = ""
+	}
+}
+
+// flush passes a trailing line without newline to fn
+func (f *followedFile) flush(fn func(string)) {
+	if f.partial != "" {
+		fn(f.partial)
+		f.partial = ""
+	}
+}
+
+// reopenIfRotated switches to the new file once the followed one has been rotated
+func (f *followedFile) reopenIfRotated(fn func(string)) error {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		// The new file is not created yet
+		return nil
+	}
+	if f.file != nil {
+		current, err := f.file.Stat()
+		if err == nil && os.SameFile(info, current) {
+			return nil
+		}
+		f.readLines(fn)
+		f.flush(fn)
+		f.close()
+	}
+	if err := f.open(); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	f.readLines(fn)
+	return nil
+}
+
+// resolveLogJob finds the job matching query among the jobs in the state file
+// and the jobs that have stored output
+func resolveLogJob(query string, dir string) (string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+	var stored []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			stored = append(stored, entry.Name())
+		}
+	}
+	return resolveJobIDWith(query, stored)
+}
+
+// jobActive reports whether the job is in the state file and its process is running
+func jobActive(jobID string) bool {
+	stateMutex.Lock()
+	jobs, _ := readStateFile(GetStateFile())
+	stateMutex.Unlock()
+	for _, job := range jobs {
+		if job.JobID == jobID {
+			return !job.IsStale
+		}
+	}
+	return false
+}
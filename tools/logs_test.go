@@ -0,0 +1,117 @@
+package tools
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMatchJobID(t *testing.T) {
+	jobs := []JobState{
+		{JobID: "3f2a11"},
+		{JobID: "3f2b22", Name: "web"},
+		{JobID: "a91c33"},
+		{JobID: "a91c33"},
+	}
+	tests := []struct {
+		query   string
+		want    string
+		wantErr string
+	}{
+		{"3f2a11", "3f2a11", ""},
+		{"3f2a", "3f2a11", ""},
+		{"a9", "a91c33", ""},
+		{"web", "3f2b22", ""},
+		{"3f", "", "ambiguous"},
+		{"ff", "", "no job matches"},
+		{"", "", "no job ID"},
+	}
+
+	for _, tt := range tests {
+		got, err := matchJobID(tt.query, jobs)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("matchJobID(%q) error = %v, want error containing %q", tt.query, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("matchJobID(%q) = %q, %v, want %q", tt.query, got, err, tt.want)
+		}
+	}
+}
+
+func TestShowLogs(t *testing.T) {
+	setupTestLogFile(t)
+	dir := t.TempDir()
+
+	l, err := openOutputLog(OutputLogConfig{Dir: dir, MaxSize: 300, Keep: 5, Compress: true}, "3f2a11")
+	if err != nil {
+		t.Fatalf("openOutputLog() error: %v", err)
+	}
+	old := time.Now().Add(-2 * time.Hour)
+	for run := 1; run <= 3; run++ {
+		ts := old
+		if run == 3 {
+			ts = time.Now()
+		}
+		l.writeEntry(run, "run4ever", "==> run started", ts)
+		l.writeEntry(run, "stdout", "out "+string(rune('0'+run)), ts)
+		l.writeEntry(run, "stderr", "err "+string(rune('0'+run)), ts)
+	}
+	l.close()
+	if len(rotatedLogFiles(filepath.Join(dir, "3f2a11"))) == 0 {
+		t.Fatal("expected the test log to be rotated")
+	}
+
+	tests := []struct {
+		name       string
+		opts       LogsOptions
+		wantStdout string
+		wantStderr string
+	}{
+		{"all", LogsOptions{Tail: -1}, "==> run started\nout 1\n==> run started\nout 2\n==> run started\nout 3\n", "err 1\nerr 2\nerr 3\n"},
+		{"tail", LogsOptions{Tail: 2}, "out 3\n", "err 3\n"},
+		{"run", LogsOptions{Tail: -1, Run: 2}, "==> run started\nout 2\n", "err 2\n"},
+		{"stderr only", LogsOptions{Tail: -1, StderrOnly: true}, "", "err 1\nerr 2\nerr 3\n"},
+		{"since", LogsOptions{Tail: -1, Since: time.Hour}, "==> run started\nout 3\n", "err 3\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			tt.opts.Dir = dir
+			if err := ShowLogs("3f2", tt.opts, &stdout, &stderr); err != nil {
+				t.Fatalf("ShowLogs() error: %v", err)
+			}
+			if stdout.String() != tt.wantStdout {
+				t.Errorf("stdout = %q, want %q", stdout.String(), tt.wantStdout)
+			}
+			if stderr.String() != tt.wantStderr {
+				t.Errorf("stderr = %q, want %q", stderr.String(), tt.wantStderr)
+			}
+		})
+	}
+
+	if err := ShowLogs("ff", LogsOptions{Dir: dir}, &bytes.Buffer{}, &bytes.Buffer{}); err == nil {
+		t.Error("ShowLogs() with an unknown job should fail")
+	}
+}
+
+func TestParseOutputLine(t *testing.T) {
+	entry, ok := parseOutputLine("2024-05-01T10:00:00.5Z 7 stderr some text here\n")
+	if !ok {
+		t.Fatal("parseOutputLine() failed")
+	}
+	if entry.run != 7 || entry.stream != "stderr" || entry.text != "some text here" || entry.time.Nanosecond() != 500000000 {
+		t.Errorf("parseOutputLine() = %+v", entry)
+	}
+	if _, ok := parseOutputLine("garbage"); ok {
+		t.Error("parseOutputLine(garbage) should fail")
+	}
+	if entry, ok := parseOutputLine("2024-05-01T10:00:00Z 1 stdout "); !ok || entry.text != "" {
+		t.Errorf("parseOutputLine() with empty text = %+v, %v", entry, ok)
+	}
+}
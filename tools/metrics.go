@@ -0,0 +1,205 @@
+package tools
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// durationBuckets are the upper bounds of the run duration histogram, in seconds
+var durationBuckets = []float64{0.1, 0.5, 1, 5, 10, 30, 60, 300, 900, 3600}
+
+// breakerStates are the values of the breaker state metric
+var breakerStates = []string{"closed", "half-open", "open"}
+
+// jobMetrics collects the metrics of the job run by RunInfinitely
+type jobMetrics struct {
+	mu             sync.Mutex
+	jobID          string
+	jobName        string
+	runs           map[string]uint64 // by result
+	started        time.Time
+	hasRun         bool
+	last           runResult
+	lastSuccess    bool
+	bucketCounts   []uint64
+	durationSum    float64
+	durationCount  uint64
+	retries        int
+	breaker        string
+	notifyFailures map[string]uint64 // by notification method
+}
+
+var metrics = newJobMetrics()
+
+func newJobMetrics() *jobMetrics {
+	return &jobMetrics{
+		started:        time.Now(),
+		runs:           map[string]uint64{},
+		bucketCounts:   make([]uint64, len(durationBuckets)),
+		notifyFailures: map[string]uint64{},
+	}
+}
+
+// setJob sets the labels identifying the job. The job is named after the
+// basename of its command unless it was given a name.
+func (m *jobMetrics) setJob(jobID string, name string, args []string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.jobID = jobID
+	switch {
+	case name != "":
+		m.jobName = name
+	case len(args) > 0:
+		m.jobName = filepath.Base(args[0])
+	}
+}
+
+// observeRun records a finished run
+func (m *jobMetrics) observeRun(res runResult, success bool, retries int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	result := "success"
+	if !success {
+		result = "failure"
+	}
+	m.runs[result]++
+	m.hasRun = true
+	m.last = res
+	m.lastSuccess = success
+	m.retries = retries
+
+	seconds := res.end.Sub(res.start).Seconds()
+	for i, bound := range durationBuckets {
+		if seconds <= bound {
+			m.bucketCounts[i]++
+		}
+	}
+	m.durationSum += seconds
+	m.durationCount++
+}
+
+// setBreaker records the circuit breaker state, empty when closed
+func (m *jobMetrics) setBreaker(state string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.breaker = strings.ToLower(state)
+}
+
+// notifyFailed counts a notification that could not be sent
+func (m *jobMetrics) notifyFailed(method string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.notifyFailures[method]++
+}
+
+// write renders the metrics in the Prometheus text exposition format
+func (m *jobMetrics) write(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	labels := fmt.Sprintf(`job_id="%s",job_name="%s"`, escapeLabel(m.jobID), escapeLabel(m.jobName))
+
+	writeHeader(w, "run4ever_runs_total", "counter", "Number of finished runs by result.")
+	for _, result := range []string{"success", "failure"} {
+		fmt.Fprintf(w, "run4ever_runs_total{%s,result=\"%s\"} %d\n", labels, result, m.runs[result])
+	}
+
+	if m.hasRun {
+		writeHeader(w, "run4ever_last_exit_code", "gauge", "Exit status of the last run.")
+		fmt.Fprintf(w, "run4ever_last_exit_code{%s} %d\n", labels, m.last.exitStatus)
+		writeHeader(w, "run4ever_last_run_timestamp_seconds", "gauge", "Unix time at which the last run finished.")
+		fmt.Fprintf(w, "run4ever_last_run_timestamp_seconds{%s} %s\n", labels, formatFloat(float64(m.last.end.UnixNano())/1e9))
+	}
+
+	writeHeader(w, "run4ever_run_duration_seconds", "histogram", "Duration of the runs.")
+	for i, bound := range durationBuckets {
+		fmt.Fprintf(w, "run4ever_run_duration_seconds_bucket{%s,le=\"%s\"} %d\n", labels, formatFloat(bound), m.bucketCounts[i])
+	}
+	fmt.Fprintf(w, "run4ever_run_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", labels, m.durationCount)
+	fmt.Fprintf(w, "run4ever_run_duration_seconds_sum{%s} %s\n", labels, formatFloat(m.durationSum))
+	fmt.Fprintf(w, "run4ever_run_duration_seconds_count{%s} %d\n", labels, m.durationCount)
+
+	writeHeader(w, "run4ever_retry_count", "gauge", "Failed runs counted towards --max-retries.")
+	fmt.Fprintf(w, "run4ever_retry_count{%s} %d\n", labels, m.retries)
+
+	writeHeader(w, "run4ever_breaker_state", "gauge", "Circuit breaker state, 1 for the current state.")
+	current := m.breaker
+	if current == "" {
+		current = "closed"
+	}
+	for _, state := range breakerStates {
+		value := 0
+		if state == current {
+			value = 1
+		}
+		fmt.Fprintf(w, "run4ever_breaker_state{%s,state=\"%s\"} %d\n", labels, state, value)
+	}
+
+	writeHeader(w, "run4ever_notification_failures_total", "counter", "Notifications that could not be sent, by method.")
+	methods := make([]string, 0, len(m.notifyFailures))
+	for method := range m.notifyFailures {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+	for _, method := range methods {
+		fmt.Fprintf(w, "run4ever_notification_failures_total{%s,method=\"%s\"} %d\n", labels, escapeLabel(method), m.notifyFailures[method])
+	}
+}
+
+func writeHeader(w io.Writer, name string, kind string, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// httpServers holds the muxes of the addresses served so far, so that several
+// endpoints can share one address
+var (
+	httpServersMutex sync.Mutex
+	httpServers      = map[string]*http.ServeMux{}
+)
+
+// serveHandler registers handler for pattern on addr, listening on addr first
+// unless it is already served
+func serveHandler(addr string, pattern string, handler http.Handler) error {
+	httpServersMutex.Lock()
+	defer httpServersMutex.Unlock()
+	mux, ok := httpServers[addr]
+	if !ok {
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			return fmt.Errorf("failed to listen on %s: %w", addr, err)
+		}
+		mux = http.NewServeMux()
+		httpServers[addr] = mux
+		go http.Serve(ln, mux)
+	}
+	mux.Handle(pattern, handler)
+	return nil
+}
+
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+func formatFloat(f float64) string {
+	return fmt.Sprintf("%g", f)
+}
+
+// ServeMetrics serves the job's metrics at /metrics on addr in the Prometheus
+// text format. It returns once the address is bound and serves in the background.
+func ServeMetrics(addr string) error {
+	return serveHandler(addr, "/metrics", metricsHandler(metrics))
+}
+
+func metricsHandler(m *jobMetrics) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		m.write(w)
+	})
+}
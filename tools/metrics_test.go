@@ -0,0 +1,99 @@
+package tools
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetricsEndpoint(t *testing.T) {
+	m := newJobMetrics()
+	m.setJob("3f2a11", "", []string{"/usr/bin/backup", "--all"})
+
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	m.observeRun(runResult{start: start, end: start.Add(300 * time.Millisecond)}, true, 0)
+	m.observeRun(runResult{start: start, end: start.Add(20 * time.Second), exitStatus: 3}, false, 1)
+	m.setBreaker("HALF-OPEN")
+	m.notifyFailed("slack")
+	m.notifyFailed("slack")
+
+	server := httptest.NewServer(metricsHandler(m))
+	defer server.Close()
+	resp, err := http.Get(server.URL + "/metrics")
+	if err != nil {
+		t.Fatalf("GET /metrics error: %v", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	out := string(body)
+
+	labels := `job_id="3f2a11",job_name="backup"`
+	for _, want := range []string{
+		`# TYPE run4ever_runs_total counter`,
+		`run4ever_runs_total{` + labels + `,result="success"} 1`,
+		`run4ever_runs_total{` + labels + `,result="failure"} 1`,
+		`run4ever_last_exit_code{` + labels + `} 3`,
+		`run4ever_last_run_timestamp_seconds{` + labels + `} 1.71456482e+09`,
+		`run4ever_run_duration_seconds_bucket{` + labels + `,le="0.1"} 0`,
+		`run4ever_run_duration_seconds_bucket{` + labels + `,le="0.5"} 1`,
+		`run4ever_run_duration_seconds_bucket{` + labels + `,le="30"} 2`,
+		`run4ever_run_duration_seconds_bucket{` + labels + `,le="+Inf"} 2`,
+		`run4ever_run_duration_seconds_sum{` + labels + `} 20.3`,
+		`run4ever_run_duration_seconds_count{` + labels + `} 2`,
+		`run4ever_retry_count{` + labels + `} 1`,
+		`run4ever_breaker_state{` + labels + `,state="closed"} 0`,
+		`run4ever_breaker_state{` + labels + `,state="half-open"} 1`,
+		`run4ever_notification_failures_total{` + labels + `,method="slack"} 2`,
+	} {
+		if !strings.Contains(out, want+"\n") {
+			t.Errorf("metrics do not contain %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestMetricsBeforeFirstRun(t *testing.T) {
+	m := newJobMetrics()
+	m.setJob("abc", "", []string{"sleep", "1"})
+
+	var out strings.Builder
+	m.write(&out)
+	if strings.Contains(out.String(), "run4ever_last_exit_code") {
+		t.Errorf("last exit code reported before the first run:\n%s", out.String())
+	}
+	if !strings.Contains(out.String(), `run4ever_breaker_state{job_id="abc",job_name="sleep",state="closed"} 1`) {
+		t.Errorf("breaker is not reported as closed:\n%s", out.String())
+	}
+}
+
+func TestEscapeLabel(t *testing.T) {
+	if got := escapeLabel("a\"b\\c\nd"); got != `a\"b\\c\nd` {
+		t.Errorf("escapeLabel() = %q", got)
+	}
+}
+
+func TestMetricsJobName(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"", []string{"/usr/bin/backup", "--all"}, "backup"},
+		{"nightly-backup", []string{"/usr/bin/backup", "--all"}, "nightly-backup"},
+	}
+	for _, tt := range tests {
+		m := newJobMetrics()
+		m.setJob("3f2a11", tt.name, tt.args)
+		var out strings.Builder
+		m.write(&out)
+		want := `job_id="3f2a11",job_name="` + tt.want + `"`
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("setJob(%q) labels do not contain %q:\n%s", tt.name, want, out.String())
+		}
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"net/smtp"
 	"net/url"
+	"os"
 	"strings"
 
 	"github.com/gen2brain/beeep"
@@ -14,9 +15,9 @@ import (
 
 func SendDesktopNotification(title, message string, verbose bool) error {
 	if verbose {
-		fmt.Println("Sending desktop notification")
-		fmt.Println("Title: ", title)
-		fmt.Println("Message: ", message)
+		fmt.Fprintln(os.Stderr, "Sending desktop notification")
+		fmt.Fprintln(os.Stderr, "Title: ", title)
+		fmt.Fprintln(os.Stderr, "Message: ", message)
 	}
 	return beeep.Notify(title, message, "")
 }
@@ -33,12 +34,12 @@ func SendTelegramNotification(token, chatID, message string, telegramCustomAPI s
 	}
 
 	if verbose {
-		fmt.Println("Sending Telegram notification")
+		fmt.Fprintln(os.Stderr, "Sending Telegram notification")
 		maskedToken := fmt.Sprintf("********%s", token[3:])
-		fmt.Println("Token: ", maskedToken)
-		fmt.Println("Chat ID: ", chatID)
-		fmt.Println("Message: ", message)
-		fmt.Println("Using API URL: ", baseURL)
+		fmt.Fprintln(os.Stderr, "Token: ", maskedToken)
+		fmt.Fprintln(os.Stderr, "Chat ID: ", chatID)
+		fmt.Fprintln(os.Stderr, "Message: ", message)
+		fmt.Fprintln(os.Stderr, "Using API URL: ", baseURL)
 	}
 
 	apiURL := fmt.Sprintf("%s/bot%s/sendMessage", baseURL, token)
@@ -47,7 +48,7 @@ func SendTelegramNotification(token, chatID, message string, telegramCustomAPI s
 	params.Add("text", message)
 
 	if verbose {
-		fmt.Println("Sending request to: ", apiURL)
+		fmt.Fprintln(os.Stderr, "Sending request to: ", apiURL)
 	}
 	resp, err := http.PostForm(apiURL, params)
 	if err != nil {
@@ -56,7 +57,7 @@ func SendTelegramNotification(token, chatID, message string, telegramCustomAPI s
 	defer resp.Body.Close()
 
 	if verbose {
-		fmt.Println("Telegram response: ", resp.Status)
+		fmt.Fprintln(os.Stderr, "Telegram response: ", resp.Status)
 	}
 
 	if resp.StatusCode != 200 {
@@ -68,8 +69,8 @@ func SendTelegramNotification(token, chatID, message string, telegramCustomAPI s
 // SendSlackNotification sends a notification to Slack
 func SendSlackNotification(webhookURL, message string, verbose bool) error {
 	if verbose {
-		fmt.Println("Sending Slack notification")
-		fmt.Println("Message: ", message)
+		fmt.Fprintln(os.Stderr, "Sending Slack notification")
+		fmt.Fprintln(os.Stderr, "Message: ", message)
 	}
 
 	payload := map[string]string{
@@ -88,7 +89,7 @@ func SendSlackNotification(webhookURL, message string, verbose bool) error {
 	defer resp.Body.Close()
 
 	if verbose {
-		fmt.Println("Slack response: ", resp.Status)
+		fmt.Fprintln(os.Stderr, "Slack response: ", resp.Status)
 	}
 
 	if resp.StatusCode != 200 {
@@ -100,10 +101,10 @@ func SendSlackNotification(webhookURL, message string, verbose bool) error {
 // SendEmailNotification sends an email notification
 func SendEmailNotification(to, from, password, smtpHost string, smtpPort int, subject, message string, verbose bool) error {
 	if verbose {
-		fmt.Println("Sending email notification")
-		fmt.Println("To: ", to)
-		fmt.Println("From: ", from)
-		fmt.Println("SMTP: ", smtpHost, ":", smtpPort)
+		fmt.Fprintln(os.Stderr, "Sending email notification")
+		fmt.Fprintln(os.Stderr, "To: ", to)
+		fmt.Fprintln(os.Stderr, "From: ", from)
+		fmt.Fprintln(os.Stderr, "SMTP: ", smtpHost, ":", smtpPort)
 	}
 
 	// Setup authentication
@@ -120,7 +121,7 @@ func SendEmailNotification(to, from, password, smtpHost string, smtpPort int, su
 	}
 
 	if verbose {
-		fmt.Println("Email sent successfully")
+		fmt.Fprintln(os.Stderr, "Email sent successfully")
 	}
 	return nil
 }
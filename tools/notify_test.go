@@ -1,6 +1,7 @@
 package tools
 
 import (
+	"fmt"
 	"testing"
 )
 
@@ -23,7 +24,7 @@ func TestShouldNotify(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := shouldNotify(tt.notifyOn, tt.exitStatus)
+			result := shouldNotify(tt.notifyOn, ExitCodes{}.IsSuccess(tt.exitStatus))
 			if result != tt.expected {
 				t.Errorf("shouldNotify(%s, %d) = %v, want %v", tt.notifyOn, tt.exitStatus, result, tt.expected)
 			}
@@ -44,7 +45,7 @@ func TestStatusToString(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run("", func(t *testing.T) {
-			result := statusToString(tt.exitStatus)
+			result := statusToString(ExitCodes{}.IsSuccess(tt.exitStatus), false)
 			if result != tt.expected {
 				t.Errorf("statusToString(%d) = %s, want %s", tt.exitStatus, result, tt.expected)
 			}
@@ -52,6 +53,33 @@ func TestStatusToString(t *testing.T) {
 	}
 }
 
+func TestNotifyWithExitCodes(t *testing.T) {
+	codes := ExitCodes{Success: []int{0, 1, 3}, Fatal: []int{2, 127}}
+	tests := []struct {
+		notifyOn   string
+		exitStatus int
+		notify     bool
+		status     string
+	}{
+		{"success", 1, true, "Success"},
+		{"failure", 1, false, "Success"},
+		{"failure", 4, true, "Failure"},
+		{"failure", 127, true, "Fatal"},
+		{"success", 2, false, "Fatal"},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s/%d", tt.notifyOn, tt.exitStatus), func(t *testing.T) {
+			if got := shouldNotify(tt.notifyOn, codes.IsSuccess(tt.exitStatus)); got != tt.notify {
+				t.Errorf("shouldNotify(%s, %d) = %v, want %v", tt.notifyOn, tt.exitStatus, got, tt.notify)
+			}
+			if got := statusToString(codes.IsSuccess(tt.exitStatus), codes.IsFatal(tt.exitStatus)); got != tt.status {
+				t.Errorf("statusToString(%d) = %s, want %s", tt.exitStatus, got, tt.status)
+			}
+		})
+	}
+}
+
 // Test SendDesktopNotification - this will only work if desktop notifications are available
 func TestSendDesktopNotification(t *testing.T) {
 	// This test will be skipped if desktop notifications are not available
@@ -0,0 +1,157 @@
+package tools
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// maxLineLength bounds how much of a line without newline is buffered before it is emitted
+const maxLineLength = 64 * 1024
+
+// drainTimeout bounds how long to wait for output after the command exits, in case
+// a background descendant keeps the pipes open
+const drainTimeout = time.Second
+
+// lineSink receives the complete output lines of a run
+type lineSink interface {
+	writeLine(stream string, line string)
+}
+
+// outputCapture copies the stdout and stderr of a run to the terminal and to line sinks
+type outputCapture struct {
+	sinks     []lineSink
+	stdout    io.Writer // where stdout is passed through, nil to drop it
+	stderr    io.Writer // where stderr is passed through, nil to drop it
+	mu        sync.Mutex
+	wg        sync.WaitGroup
+	writeEnds []*os.File
+	bytes     map[string]int64 // bytes read per stream, guarded by mu
+}
+
+func newOutputCapture(sinks ...lineSink) *outputCapture {
+	return &outputCapture{sinks: sinks, stdout: os.Stdout, stderr: os.Stderr, bytes: map[string]int64{}}
+}
+
+// byteCount returns the number of bytes the command wrote to a stream
+func (c *outputCapture) byteCount(stream string) int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.bytes[stream]
+}
+
+// attach connects the command's stdout and stderr to pipes read by the capture.
+// The pipes are real files so that the command's Wait does not depend on them.
+func (c *outputCapture) attach(cmd *exec.Cmd) error {
+	streams := []struct {
+		name   string
+		target *io.Writer
+		term   io.Writer
+	}{
+		{"stdout", &cmd.Stdout, c.stdout},
+		{"stderr", &cmd.Stderr, c.stderr},
+	}
+	for _, s := range streams {
+		pr, pw, err := os.Pipe()
+		if err != nil {
+			c.close()
+			return err
+		}
+		*s.target = pw
+		c.writeEnds = append(c.writeEnds, pw)
+		c.wg.Add(1)
+		go c.copy(s.name, pr, s.term)
+	}
+	return nil
+}
+
+// close releases the parent's ends of the pipes so that readers see EOF once the command exits
+func (c *outputCapture) close() {
+	for _, f := range c.writeEnds {
+		f.Close()
+	}
+	c.writeEnds = nil
+}
+
+// finish closes the pipes and waits briefly for the remaining output
+func (c *outputCapture) finish() {
+	c.close()
+	done := make(chan struct{})
+	go func() {
+		c.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(drainTimeout):
+	}
+}
+
+// copy passes output through to the terminal and splits it into lines for the sinks
+func (c *outputCapture) copy(stream string, r *os.File, term io.Writer) {
+	defer c.wg.Done()
+	defer r.Close()
+
+	buf := make([]byte, 32*1024)
+	var partial []byte
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			if term != nil {
+				term.Write(buf[:n])
+			}
+			c.mu.Lock()
+			c.bytes[stream] += int64(n)
+			c.mu.Unlock()
+			partial = append(partial, buf[:n]...)
+			for {
+				i := bytes.IndexByte(partial, '\n')
+				if i < 0 {
+					break
+				}
+				c.emit(stream, partial[:i])
+				partial = partial[i+1:]
+			}
+			if len(partial) > maxLineLength {
+				c.emit(stream, partial)
+				partial = nil
+			}
+			// Keep the buffer from growing with consumed lines
+			partial = append([]byte(nil), partial...)
+		}
+		if err != nil {
+			if len(partial) > 0 {
+				c.emit(stream, partial)
+			}
+			return
+		}
+	}
+}
+
+func (c *outputCapture) emit(stream string, line []byte) {
+	text := string(bytes.TrimSuffix(line, []byte("\r")))
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, sink := range c.sinks {
+		sink.writeLine(stream, text)
+	}
+}
+
+// prefixSink writes output lines to the terminal prefixed with the time, run
+// number and stream, in the format of the output log
+type prefixSink struct {
+	run    int
+	stdout io.Writer
+	stderr io.Writer
+}
+
+func (s prefixSink) writeLine(stream string, line string) {
+	w := s.stdout
+	if stream == "stderr" {
+		w = s.stderr
+	}
+	io.WriteString(w, formatOutputLine(time.Now(), s.run, stream, line))
+}
@@ -0,0 +1,262 @@
+package tools
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OutputLogConfig controls the per-job files that store the output of every run
+type OutputLogConfig struct {
+	Dir      string        // base directory, each job writes to Dir/<job-id>, empty disables the log
+	MaxSize  int64         // rotate once the file reaches this many bytes, 0 disables size rotation
+	MaxAge   time.Duration // rotate once the file is older than this, 0 disables age rotation
+	Keep     int           // number of rotated files to keep
+	Compress bool          // gzip rotated files
+}
+
+const outputLogName = "output.log"
+
+// GetLogDir returns the default directory for job output logs
+func GetLogDir() string {
+	homeDir := os.Getenv("HOME")
+	return filepath.Join(homeDir, ".run4ever", "logs")
+}
+
+// outputLog is a rotating log file holding the output lines of a job. Each line is
+// stored as "<time> <run> <stream> <text>", where stream is stdout, stderr or
+// run4ever for the run separators.
+type outputLog struct {
+	cfg     OutputLogConfig
+	dir     string
+	mu      sync.Mutex
+	file    *os.File
+	size    int64
+	created time.Time // when the first line of the current file was written
+
+	retryRotate time.Time // a failed rotation is not retried before this time
+}
+
+func openOutputLog(cfg OutputLogConfig, jobID string) (*outputLog, error) {
+	dir := filepath.Join(cfg.Dir, jobID)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create log directory: %w", err)
+	}
+	l := &outputLog{cfg: cfg, dir: dir}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *outputLog) open() error {
+	f, err := os.OpenFile(filepath.Join(l.dir, outputLogName), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("failed to stat log file: %w", err)
+	}
+	l.file = f
+	l.size = info.Size()
+	l.created = fileCreated(f.Name(), info)
+	return nil
+}
+
+// fileCreated returns when the first line of an output log was written, so that
+// a file reopened after a restart keeps its age. Files without a readable first
+// line fall back to their modification time, and empty files are new.
+func fileCreated(path string, info os.FileInfo) time.Time {
+	if info.Size() == 0 {
+		return time.Now()
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return info.ModTime()
+	}
+	defer f.Close()
+	line, _ := bufio.NewReader(f).ReadString('\n')
+	if entry, ok := parseOutputLine(line); ok {
+		return entry.time
+	}
+	return info.ModTime()
+}
+
+// outputEntry is a parsed line of an output log
+type outputEntry struct {
+	time   time.Time
+	run    int
+	stream string
+	text   string
+}
+
+// parseOutputLine parses a line written by writeEntry
+func parseOutputLine(line string) (outputEntry, bool) {
+	parts := strings.SplitN(strings.TrimSuffix(line, "\n"), " ", 4)
+	if len(parts) < 3 {
+		return outputEntry{}, false
+	}
+	t, err := time.Parse(time.RFC3339Nano, parts[0])
+	if err != nil {
+		return outputEntry{}, false
+	}
+	run, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return outputEntry{}, false
+	}
+	entry := outputEntry{time: t, run: run, stream: parts[2]}
+	if len(parts) == 4 {
+		entry.text = parts[3]
+	}
+	return entry, true
+}
+
+// beginRun writes the separator that starts a run
+func (l *outputLog) beginRun(run int, start time.Time) {
+	l.writeEntry(run, "run4ever", fmt.Sprintf("==> run %d started at %s", run, start.Format(time.RFC3339)), start)
+}
+
+// endRun writes the separator that ends a run with its exit status
+func (l *outputLog) endRun(run int, res runResult) {
+	l.writeEntry(run, "run4ever", fmt.Sprintf("==> run %d exited with status %d%s", run, res.exitStatus, res.describe()), time.Now())
+}
+
+// formatOutputLine renders an output line as stored in the output log
+func formatOutputLine(t time.Time, run int, stream string, text string) string {
+	return fmt.Sprintf("%s %d %s %s\n", t.UTC().Format(time.RFC3339Nano), run, stream, text)
+}
+
+// writeEntry appends one line to the log, rotating it first when needed
+func (l *outputLog) writeEntry(run int, stream string, text string, t time.Time) {
+	line := formatOutputLine(t, run, stream, text)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return
+	}
+	if l.shouldRotate(int64(len(line))) {
+		if err := l.rotate(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error rotating output log: %v\n", err)
+			l.retryRotate = time.Now().Add(time.Minute)
+			if l.file == nil {
+				return
+			}
+		}
+	}
+	n, _ := l.file.WriteString(line)
+	l.size += int64(n)
+}
+
+func (l *outputLog) shouldRotate(next int64) bool {
+	if l.size == 0 || time.Now().Before(l.retryRotate) {
+		return false
+	}
+	if l.cfg.MaxSize > 0 && l.size+next > l.cfg.MaxSize {
+		return true
+	}
+	return l.cfg.MaxAge > 0 && time.Since(l.created) > l.cfg.MaxAge
+}
+
+// rotate moves the current file aside, optionally compresses it, and drops old
+// files. The log is reopened whatever fails, so that lines keep being written to
+// the unrotated file when the rename fails, and a rotated file that cannot be
+// compressed is kept as it is.
+func (l *outputLog) rotate() (err error) {
+	l.file.Close()
+	l.file = nil
+	defer func() {
+		if openErr := l.open(); err == nil {
+			err = openErr
+		}
+	}()
+
+	current := filepath.Join(l.dir, outputLogName)
+	rotated := filepath.Join(l.dir, fmt.Sprintf("output-%s.log", time.Now().UTC().Format("20060102T150405.000000000")))
+	if err := os.Rename(current, rotated); err != nil {
+		return fmt.Errorf("failed to rotate log file: %w", err)
+	}
+	if l.cfg.Compress {
+		err = gzipFile(rotated)
+	}
+	l.prune()
+	return err
+}
+
+// prune removes rotated files beyond the number to keep
+func (l *outputLog) prune() {
+	rotated := rotatedLogFiles(l.dir)
+	if len(rotated) <= l.cfg.Keep {
+		return
+	}
+	for _, name := range rotated[:len(rotated)-l.cfg.Keep] {
+		os.Remove(name)
+	}
+}
+
+func (l *outputLog) close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file != nil {
+		l.file.Close()
+		l.file = nil
+	}
+}
+
+// rotatedLogFiles lists the rotated log files of a job directory, oldest first
+func rotatedLogFiles(dir string) []string {
+	files, _ := filepath.Glob(filepath.Join(dir, "output-*.log*"))
+	sort.Strings(files)
+	return files
+}
+
+// gzipFile compresses a file into name.gz and removes the original
+func gzipFile(name string) error {
+	in, err := os.Open(name)
+	if err != nil {
+		return fmt.Errorf("failed to open rotated log: %w", err)
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(name+".gz", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create compressed log: %w", err)
+	}
+	zw := gzip.NewWriter(out)
+	if _, err := io.Copy(zw, in); err != nil {
+		zw.Close()
+		out.Close()
+		os.Remove(name + ".gz")
+		return fmt.Errorf("failed to compress rotated log: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		out.Close()
+		os.Remove(name + ".gz")
+		return fmt.Errorf("failed to compress rotated log: %w", err)
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(name + ".gz")
+		return fmt.Errorf("failed to close compressed log: %w", err)
+	}
+	return os.Remove(name)
+}
+
+// runLogSink writes the lines of one run to the job's output log
+type runLogSink struct {
+	log *outputLog
+	run int
+}
+
+func (s runLogSink) writeLine(stream string, line string) {
+	s.log.writeEntry(s.run, stream, line, time.Now())
+}
@@ -0,0 +1,236 @@
+package tools
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type recordingSink struct {
+	lines []string
+}
+
+func (s *recordingSink) writeLine(stream string, line string) {
+	s.lines = append(s.lines, stream+": "+line)
+}
+
+func TestOutputCapture(t *testing.T) {
+	sink := &recordingSink{}
+	capture := newOutputCapture(sink)
+	cmd := exec.Command("sh", "-c", "echo one; echo two >&2; printf 'three\\r\\n'; printf partial")
+	if err := capture.attach(cmd); err != nil {
+		t.Fatalf("attach() error: %v", err)
+	}
+	if err := runWithTimeout(cmd, 0, TimeoutPolicy{}); err != nil {
+		t.Fatalf("runWithTimeout() error: %v", err)
+	}
+	capture.finish()
+
+	var stdout, stderr []string
+	for _, line := range sink.lines {
+		if strings.HasPrefix(line, "stderr: ") {
+			stderr = append(stderr, line)
+		} else {
+			stdout = append(stdout, line)
+		}
+	}
+	if want := []string{"stdout: one", "stdout: three", "stdout: partial"}; !reflect.DeepEqual(stdout, want) {
+		t.Errorf("stdout lines = %q, want %q", stdout, want)
+	}
+	if want := []string{"stderr: two"}; !reflect.DeepEqual(stderr, want) {
+		t.Errorf("stderr lines = %q, want %q", stderr, want)
+	}
+}
+
+func TestOutputLogRotation(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		dir := t.TempDir()
+		l, err := openOutputLog(OutputLogConfig{Dir: dir, MaxSize: 200, Keep: 2, Compress: compress}, "job")
+		if err != nil {
+			t.Fatalf("openOutputLog() error: %v", err)
+		}
+		for i := 0; i < 20; i++ {
+			l.writeEntry(1, "stdout", strings.Repeat("x", 50), time.Now())
+		}
+		l.close()
+
+		rotated := rotatedLogFiles(filepath.Join(dir, "job"))
+		if len(rotated) != 2 {
+			t.Errorf("compress=%v: got %d rotated files, want 2: %v", compress, len(rotated), rotated)
+		}
+		for _, name := range rotated {
+			if strings.HasSuffix(name, ".gz") != compress {
+				t.Errorf("compress=%v: unexpected rotated file %s", compress, name)
+			}
+		}
+		info, err := os.Stat(filepath.Join(dir, "job", outputLogName))
+		if err != nil {
+			t.Fatalf("current log missing: %v", err)
+		}
+		if info.Size() > 200 {
+			t.Errorf("current log is %d bytes, want at most 200", info.Size())
+		}
+	}
+}
+
+func TestOutputLogRotationFailure(t *testing.T) {
+	dir := t.TempDir()
+	l, err := openOutputLog(OutputLogConfig{Dir: dir, MaxSize: 100, Keep: 2}, "job")
+	if err != nil {
+		t.Fatalf("openOutputLog() error: %v", err)
+	}
+	defer l.close()
+
+	// Removing the current file makes the rename of the next rotation fail
+	current := filepath.Join(dir, "job", outputLogName)
+	l.writeEntry(1, "stdout", strings.Repeat("x", 80), time.Now())
+	os.Remove(current)
+	l.writeEntry(1, "stdout", "after the failed rotation", time.Now())
+	l.writeEntry(1, "stdout", "still logged", time.Now())
+
+	data, err := os.ReadFile(current)
+	if err != nil {
+		t.Fatalf("output log was not reopened: %v", err)
+	}
+	for _, want := range []string{"after the failed rotation", "still logged"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("output log is missing %q:\n%s", want, data)
+		}
+	}
+}
+
+func TestOutputLogMaxAge(t *testing.T) {
+	dir := t.TempDir()
+	l, err := openOutputLog(OutputLogConfig{Dir: dir, MaxAge: time.Hour, Keep: 5}, "job")
+	if err != nil {
+		t.Fatalf("openOutputLog() error: %v", err)
+	}
+	defer l.close()
+
+	l.writeEntry(1, "stdout", "old", time.Now())
+	l.created = time.Now().Add(-2 * time.Hour)
+	l.writeEntry(2, "stdout", "new", time.Now())
+
+	if rotated := rotatedLogFiles(filepath.Join(dir, "job")); len(rotated) != 1 {
+		t.Errorf("got %d rotated files, want 1", len(rotated))
+	}
+}
+
+func TestOutputLogMaxAgeAfterRestart(t *testing.T) {
+	dir := t.TempDir()
+	cfg := OutputLogConfig{Dir: dir, MaxAge: time.Hour, Keep: 5}
+	l, err := openOutputLog(cfg, "job")
+	if err != nil {
+		t.Fatalf("openOutputLog() error: %v", err)
+	}
+	l.writeEntry(1, "stdout", "old", time.Now().Add(-2*time.Hour))
+	l.close()
+
+	// The file is reopened as if run4ever restarted, it is still two hours old
+	l, err = openOutputLog(cfg, "job")
+	if err != nil {
+		t.Fatalf("openOutputLog() error: %v", err)
+	}
+	defer l.close()
+	l.writeEntry(2, "stdout", "new", time.Now())
+
+	if rotated := rotatedLogFiles(filepath.Join(dir, "job")); len(rotated) != 1 {
+		t.Errorf("got %d rotated files, want 1", len(rotated))
+	}
+}
+
+func TestExecuteWritesOutputLog(t *testing.T) {
+	dir := t.TempDir()
+	l, err := openOutputLog(OutputLogConfig{Dir: dir, Keep: 1}, "job")
+	if err != nil {
+		t.Fatalf("openOutputLog() error: %v", err)
+	}
+	r := &runner{args: []string{"sh", "-c", "echo hello; echo oops >&2; exit 3"}, outputLog: l}
+	r.execute()
+	r.execute()
+	l.close()
+
+	data, err := os.ReadFile(filepath.Join(dir, "job", outputLogName))
+	if err != nil {
+		t.Fatalf("failed to read output log: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 8 {
+		t.Fatalf("got %d lines, want 8:\n%s", len(lines), data)
+	}
+	want := []string{
+		"1 run4ever ==> run 1 started at ",
+		"1 stdout hello",
+		"1 stderr oops",
+		"1 run4ever ==> run 1 exited with status 3",
+		"2 run4ever ==> run 2 started at ",
+	}
+	for _, w := range want {
+		if !strings.Contains(string(data), w) {
+			t.Errorf("output log does not contain %q:\n%s", w, data)
+		}
+	}
+	for _, line := range lines {
+		ts, _, _ := strings.Cut(line, " ")
+		if _, err := time.Parse(time.RFC3339Nano, ts); err != nil {
+			t.Errorf("line %q does not start with a timestamp: %v", line, err)
+		}
+	}
+}
+
+func TestExecuteOutputStreams(t *testing.T) {
+	setupTestLogFile(t)
+	tests := []struct {
+		name       string
+		opts       RunOptions
+		wantStdout []string
+		wantStderr []string
+	}{
+		{"separate", RunOptions{}, []string{"out"}, []string{"err"}},
+		{"merged", RunOptions{MergeOutput: true}, []string{"out", "err"}, nil},
+		{"prefixed", RunOptions{PrefixOutput: true}, []string{"1 stdout out"}, []string{"1 stderr err"}},
+		{"prefixed and merged", RunOptions{PrefixOutput: true, MergeOutput: true}, []string{"1 stdout out", "1 stderr err"}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			stdoutFile, _ := os.Create(filepath.Join(dir, "stdout"))
+			stderrFile, _ := os.Create(filepath.Join(dir, "stderr"))
+			origStdout, origStderr := os.Stdout, os.Stderr
+			os.Stdout, os.Stderr = stdoutFile, stderrFile
+			r := &runner{args: []string{"sh", "-c", "echo out; sleep 0.1; echo err >&2"}, opts: tt.opts}
+			r.execute()
+			os.Stdout, os.Stderr = origStdout, origStderr
+			stdoutFile.Close()
+			stderrFile.Close()
+
+			check := func(name string, want []string) {
+				data, _ := os.ReadFile(filepath.Join(dir, name))
+				var got []string
+				for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+					if line == "" {
+						continue
+					}
+					if tt.opts.PrefixOutput {
+						entry, ok := parseOutputLine(line)
+						if !ok || time.Since(entry.time) > time.Minute {
+							t.Errorf("%s line %q has no valid prefix", name, line)
+						}
+						line = line[strings.Index(line, " ")+1:]
+					}
+					got = append(got, line)
+				}
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("%s = %q, want %q", name, got, want)
+				}
+			}
+			check("stdout", tt.wantStdout)
+			check("stderr", tt.wantStderr)
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package tools
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+)
+
+// OutputMatchers override the exit-code verdict of a run based on its output
+type OutputMatchers struct {
+	Fail    []*regexp.Regexp // a matching line makes the run a failure
+	Succeed []*regexp.Regexp // a matching line makes the run a success, unless a Fail pattern matched too
+}
+
+func (m OutputMatchers) enabled() bool {
+	return len(m.Fail) > 0 || len(m.Succeed) > 0
+}
+
+// CompilePatterns compiles the regular expressions given to an output matcher flag
+func CompilePatterns(flag string, patterns []string) ([]*regexp.Regexp, error) {
+	var compiled []*regexp.Regexp
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s pattern %q: %w", flag, p, err)
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+// outputMatch records the first lines of a run that match the output patterns
+type outputMatch struct {
+	matchers    OutputMatchers
+	mu          sync.Mutex
+	failLine    string
+	failed      bool
+	succeedLine string
+	succeeded   bool
+}
+
+func (m *outputMatch) writeLine(stream string, line string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.failed && matchAny(m.matchers.Fail, line) {
+		m.failed = true
+		m.failLine = line
+	}
+	if !m.succeeded && matchAny(m.matchers.Succeed, line) {
+		m.succeeded = true
+		m.succeedLine = line
+	}
+}
+
+// apply stores the verdict of the output patterns in the result of the run
+func (m *outputMatch) apply(res *runResult) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	switch {
+	case m.failed:
+		res.matched = "fail"
+		res.matchedLine = m.failLine
+	case m.succeeded:
+		res.matched = "succeed"
+		res.matchedLine = m.succeedLine
+	}
+}
+
+func matchAny(patterns []*regexp.Regexp, line string) bool {
+	for _, re := range patterns {
+		if re.MatchString(line) {
+			return true
+		}
+	}
+	return false
+}
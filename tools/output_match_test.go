@@ -0,0 +1,76 @@
+package tools
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCompilePatterns(t *testing.T) {
+	patterns, err := CompilePatterns("--fail-on-output", []string{"ERROR", `connection (refused|reset)`})
+	if err != nil || len(patterns) != 2 {
+		t.Fatalf("CompilePatterns() = %v, %v", patterns, err)
+	}
+	if _, err := CompilePatterns("--fail-on-output", []string{"("}); err == nil || !strings.Contains(err.Error(), "--fail-on-output") {
+		t.Errorf("CompilePatterns() with an invalid pattern, error = %v", err)
+	}
+}
+
+func TestOutputMatchers(t *testing.T) {
+	fail, _ := CompilePatterns("--fail-on-output", []string{"ERROR", "connection refused"})
+	succeed, _ := CompilePatterns("--succeed-on-output", []string{`^sync complete`})
+	matchers := OutputMatchers{Fail: fail, Succeed: succeed}
+
+	tests := []struct {
+		name        string
+		script      string
+		success     bool
+		matched     string
+		matchedLine string
+	}{
+		{"exit code decides without a match", "echo working; exit 3", false, "", ""},
+		{"fail pattern overrides exit 0", "echo 'ERROR: password=hunter2'; exit 0", false, "fail", "ERROR: password=hunter2"},
+		{"fail pattern on stderr", "echo 'dial tcp: connection refused' >&2", false, "fail", "dial tcp: connection refused"},
+		{"succeed pattern overrides exit 1", "echo 'sync complete, 3 warnings'; exit 1", true, "succeed", "sync complete, 3 warnings"},
+		{"fail pattern wins over succeed pattern", "echo 'sync complete'; echo ERROR", false, "fail", "ERROR"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &runner{args: []string{"sh", "-c", tt.script}, opts: RunOptions{OutputMatchers: matchers}}
+			res := r.execute()
+			if res.matched != tt.matched || res.matchedLine != tt.matchedLine {
+				t.Errorf("matched = %q %q, want %q %q", res.matched, res.matchedLine, tt.matched, tt.matchedLine)
+			}
+			if got := res.succeeded(ExitCodes{}); got != tt.success {
+				t.Errorf("succeeded() = %v, want %v", got, tt.success)
+			}
+		})
+	}
+}
+
+func TestRunResultDescribeMatch(t *testing.T) {
+	res := runResult{matched: "fail", matchedLine: "ERROR token=abc123"}
+	want := ` (output matched --fail-on-output: "ERROR token=******")`
+	if got := res.describe(); got != want {
+		t.Errorf("describe() = %q, want %q", got, want)
+	}
+
+	res = runResult{exitStatus: 124, timedOut: true, signal: "SIGTERM", matched: "succeed", matchedLine: "done"}
+	want = ` (timed out, stopped with SIGTERM, output matched --succeed-on-output: "done")`
+	if got := res.describe(); got != want {
+		t.Errorf("describe() = %q, want %q", got, want)
+	}
+}
+
+func TestFatalOverriddenByOutput(t *testing.T) {
+	codes := ExitCodes{Fatal: []int{2}}
+	if !(runResult{exitStatus: 2}).fatal(codes) {
+		t.Error("exit status 2 should be fatal")
+	}
+	if (runResult{exitStatus: 2, matched: "succeed"}).fatal(codes) {
+		t.Error("a --succeed-on-output match should override the fatal exit status")
+	}
+	if !(runResult{exitStatus: 2, matched: "fail"}).fatal(codes) {
+		t.Error("a --fail-on-output match should keep the fatal exit status")
+	}
+}
@@ -0,0 +1,97 @@
+package tools
+
+import (
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// messageLimits are the maximum message sizes of the notification channels, in characters
+var messageLimits = map[string]int{
+	"telegram": 4096,
+	"slack":    40000,
+	"email":    100000,
+}
+
+const (
+	outputTailHeader = "\n\nLast output:\n"
+	outputTailCut    = "...\n"
+)
+
+// outputTail keeps the last lines of a run's output in a ring buffer
+type outputTail struct {
+	mu    sync.Mutex
+	lines []string
+	next  int
+	full  bool
+}
+
+func newOutputTail(size int) *outputTail {
+	return &outputTail{lines: make([]string, size)}
+}
+
+func (t *outputTail) writeLine(stream string, line string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.lines[t.next] = line
+	t.next = (t.next + 1) % len(t.lines)
+	if t.next == 0 {
+		t.full = true
+	}
+}
+
+// snapshot returns the kept lines, oldest first
+func (t *outputTail) snapshot() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.full {
+		return append([]string(nil), t.lines[:t.next]...)
+	}
+	return append(append([]string(nil), t.lines[t.next:]...), t.lines[:t.next]...)
+}
+
+// withOutputTail appends the masked output of a run to a notification message.
+// The oldest lines are dropped when the message would exceed the size limit of
+// the notification method. Desktop notifications are left unchanged.
+func withOutputTail(message string, lines []string, method string) string {
+	limit, ok := messageLimits[method]
+	if !ok || len(lines) == 0 {
+		return message
+	}
+
+	budget := limit - utf8.RuneCountInString(message) - utf8.RuneCountInString(outputTailHeader) - len(outputTailCut)
+	if budget <= 0 {
+		return message
+	}
+
+	var kept []string
+	used := 0
+	cut := false
+	for i := len(lines) - 1; i >= 0; i-- {
+		line := MaskOutput(lines[i])
+		n := utf8.RuneCountInString(line)
+		if used > 0 {
+			n++ // newline
+		}
+		if used+n > budget {
+			cut = true
+			if len(kept) == 0 {
+				// A single line longer than the limit, keep its end
+				runes := []rune(line)
+				kept = append(kept, string(runes[len(runes)-budget:]))
+			}
+			break
+		}
+		kept = append(kept, line)
+		used += n
+	}
+
+	for i, j := 0, len(kept)-1; i < j; i, j = i+1, j-1 {
+		kept[i], kept[j] = kept[j], kept[i]
+	}
+	tail := strings.Join(kept, "\n")
+	if cut {
+		tail = outputTailCut + tail
+	}
+	return message + outputTailHeader + tail
+}
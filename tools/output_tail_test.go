@@ -0,0 +1,93 @@
+package tools
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestOutputTail(t *testing.T) {
+	tail := newOutputTail(3)
+	if got := tail.snapshot(); len(got) != 0 {
+		t.Errorf("snapshot() of an empty tail = %q", got)
+	}
+	tail.writeLine("stdout", "one")
+	tail.writeLine("stderr", "two")
+	if got, want := tail.snapshot(), []string{"one", "two"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("snapshot() = %q, want %q", got, want)
+	}
+	for _, line := range []string{"three", "four", "five"} {
+		tail.writeLine("stdout", line)
+	}
+	if got, want := tail.snapshot(), []string{"three", "four", "five"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("snapshot() = %q, want %q", got, want)
+	}
+}
+
+func TestWithOutputTail(t *testing.T) {
+	lines := []string{"starting", "password=hunter2", "error: disk full"}
+
+	got := withOutputTail("Command failed", lines, "slack")
+	want := "Command failed\n\nLast output:\nstarting\npassword=******\nerror: disk full"
+	if got != want {
+		t.Errorf("withOutputTail() = %q, want %q", got, want)
+	}
+
+	if got := withOutputTail("Command failed", lines, "desktop"); got != "Command failed" {
+		t.Errorf("withOutputTail() for desktop = %q, want the message unchanged", got)
+	}
+	if got := withOutputTail("Command failed", nil, "slack"); got != "Command failed" {
+		t.Errorf("withOutputTail() without output = %q, want the message unchanged", got)
+	}
+}
+
+func TestWithOutputTailLimits(t *testing.T) {
+	var lines []string
+	for i := 0; i < 5000; i++ {
+		lines = append(lines, fmt.Sprintf("line %04d of the output", i))
+	}
+
+	for method, limit := range messageLimits {
+		got := withOutputTail("Command failed", lines, method)
+		if n := utf8.RuneCountInString(got); n > limit {
+			t.Errorf("%s: message has %d characters, limit is %d", method, n, limit)
+		}
+		if !strings.HasSuffix(got, "line 4999 of the output") {
+			t.Errorf("%s: message does not end with the last line", method)
+		}
+		if !strings.Contains(got, "Last output:\n...\n") {
+			t.Errorf("%s: message does not mark the dropped lines", method)
+		}
+	}
+
+	long := strings.Repeat("x", 5000) + "END"
+	got := withOutputTail("Command failed", []string{long}, "telegram")
+	if n := utf8.RuneCountInString(got); n > messageLimits["telegram"] || !strings.HasSuffix(got, "END") {
+		t.Errorf("long line: message has %d characters and suffix %q", n, got[len(got)-3:])
+	}
+}
+
+func TestExecuteKeepsOutputTail(t *testing.T) {
+	r := &runner{
+		args:     []string{"sh", "-c", "for i in 1 2 3 4 5; do echo line $i; done; sleep 0.1; echo failed >&2; exit 2"},
+		notifyOn: "failure",
+		opts:     RunOptions{NotifyOutputLines: 3},
+	}
+	res := r.execute()
+	if res.exitStatus != 2 {
+		t.Fatalf("exit status = %d, want 2", res.exitStatus)
+	}
+	// stdout and stderr are read concurrently, so the pause before the stderr line
+	// lets the stdout lines arrive first, and only the set of lines is checked
+	joined := strings.Join(res.output, "\n")
+	if len(res.output) != 3 || !strings.Contains(joined, "line 5") || !strings.Contains(joined, "failed") {
+		t.Errorf("output = %q, want the last 3 lines", res.output)
+	}
+
+	r.notifyOn = ""
+	if res := r.execute(); res.output != nil {
+		t.Errorf("output = %q, want nothing kept without notifications", res.output)
+	}
+}
@@ -1,6 +1,7 @@
 package tools
 
 import (
+	"regexp"
 	"strings"
 )
 
@@ -13,6 +14,13 @@ var passwordFlags = []string{
 	"--email-pass", "--email-token",
 }
 
+var (
+	// secretValuePattern matches key=value and key: value pairs whose key names a secret
+	secretValuePattern = regexp.MustCompile(`(?i)((?:password|passwd|secret|token|api[_-]?key|auth[_-]?key|access[_-]?key)["']?\s*[=:]\s*["']?)[^\s"'&,;]+`)
+	// bearerPattern matches bearer credentials, e.g. in a logged Authorization header
+	bearerPattern = regexp.MustCompile(`(?i)(bearer\s+)[A-Za-z0-9._~+/=-]+`)
+)
+
 func MaskPassword(args []string) []string {
 	var maskedArgs []string
 	skipNext := false
@@ -48,4 +56,12 @@ func MaskPassword(args []string) []string {
 	}
 
 	return maskedArgs
-}
\ No newline at end of file
+}
+
+// MaskOutput masks secrets in a line of command output: values of the password
+// flags masked by MaskPassword, key=value secrets and bearer tokens
+func MaskOutput(line string) string {
+	line = strings.Join(MaskPassword(strings.Split(line, " ")), " ")
+	line = secretValuePattern.ReplaceAllString(line, "${1}******")
+	return bearerPattern.ReplaceAllString(line, "${1}******")
+}
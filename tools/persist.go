@@ -6,20 +6,70 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
+	"strings"
 )
 
-// JobDefinition represents a job that can be persisted and restored
+// JobDefinition represents a job that can be persisted and restored. The
+// settings after ExitOnSuccess are only restored when their flag is listed in
+// Flags, so that zero values given on the command line are kept and jobs saved
+// without a setting get its default.
 type JobDefinition struct {
-	Command          []string `json:"command"`
-	Delay            int      `json:"delay"`
-	MaxRetries       int      `json:"max_retries"`
-	Timeout          int      `json:"timeout"`
-	NotifyOn         string   `json:"notify_on"`
-	NotifyMethod     string   `json:"notify_method"`
-	TelegramToken    string   `json:"telegram_token,omitempty"`
-	TelegramChatID   string   `json:"telegram_chat_id,omitempty"`
-	TelegramCustomAPI string  `json:"telegram_custom_api,omitempty"`
-	ExitOnSuccess    bool     `json:"exit_on_success"`
+	Command           []string `json:"command"`
+	Delay             int      `json:"delay"`
+	MaxRetries        int      `json:"max_retries"`
+	Timeout           int      `json:"timeout"`
+	NotifyOn          string   `json:"notify_on"`
+	NotifyMethod      string   `json:"notify_method"`
+	TelegramToken     string   `json:"telegram_token,omitempty"`
+	TelegramChatID    string   `json:"telegram_chat_id,omitempty"`
+	TelegramCustomAPI string   `json:"telegram_custom_api,omitempty"`
+	ExitOnSuccess     bool     `json:"exit_on_success"`
+
+	Flags             []string `json:"flags,omitempty"` // names of the flags given on the command line
+	Name              string   `json:"name,omitempty"`
+	Tags              []string `json:"tags,omitempty"`
+	Backoff           Backoff  `json:"backoff"`
+	Schedule          string   `json:"schedule,omitempty"`
+	Timezone          string   `json:"timezone,omitempty"`
+	MissedRuns        string   `json:"missed_runs,omitempty"`
+	Rate              bool     `json:"rate,omitempty"`
+	Overlap           string   `json:"overlap,omitempty"`
+	MaxConcurrent     int      `json:"max_concurrent,omitempty"`
+	SuccessCodes      []int    `json:"success_codes,omitempty"`
+	FatalCodes        []int    `json:"fatal_codes,omitempty"`
+	TimeoutSignal     string   `json:"timeout_signal,omitempty"`
+	KillAfter         int      `json:"kill_after,omitempty"`
+	ForwardSignals    []string `json:"forward_signals,omitempty"`
+	StopTimeout       int      `json:"stop_timeout,omitempty"`
+	HUPRestart        bool     `json:"hup_restart,omitempty"`
+	Init              bool     `json:"init,omitempty"`
+	MaxFailures       int      `json:"max_failures,omitempty"`
+	FailureWindow     string   `json:"failure_window,omitempty"`
+	ResetOnSuccess    bool     `json:"reset_on_success,omitempty"`
+	BreakerFailures   int      `json:"breaker_failures,omitempty"`
+	Cooldown          string   `json:"cooldown,omitempty"`
+	ProbeCommand      string   `json:"probe_command,omitempty"`
+	LogDir            string   `json:"log_dir,omitempty"`
+	LogMaxSize        int      `json:"log_max_size,omitempty"`
+	LogMaxAge         string   `json:"log_max_age,omitempty"`
+	LogKeep           int      `json:"log_keep,omitempty"`
+	LogCompress       bool     `json:"log_compress,omitempty"`
+	NotifyOutputLines int      `json:"notify_output_lines,omitempty"`
+	FailOnOutput      []string `json:"fail_on_output,omitempty"`
+	SucceedOnOutput   []string `json:"succeed_on_output,omitempty"`
+	HistoryDir        string   `json:"history_dir,omitempty"`
+	HistoryMaxRuns    int      `json:"history_max_runs,omitempty"`
+	HistoryMaxAge     string   `json:"history_max_age,omitempty"`
+	MetricsAddr       string   `json:"metrics_addr,omitempty"`
+	HealthAddr        string   `json:"health_addr,omitempty"`
+	ReadyMaxAge       string   `json:"ready_max_age,omitempty"`
+	LogFormat         string   `json:"log_format,omitempty"`
+	LogFile           string   `json:"log_file,omitempty"`
+	PrefixOutput      bool     `json:"prefix_output,omitempty"`
+	MergeOutput       bool     `json:"merge_output,omitempty"`
+	StaleMaxAge       string   `json:"stale_max_age,omitempty"`
+	ArchiveStale      bool     `json:"archive_stale,omitempty"`
 }
 
 // GetJobsFile returns the path to the jobs persistence file
@@ -38,6 +88,13 @@ func SaveJobDefinition(job JobDefinition) error {
 		return fmt.Errorf("failed to create jobs directory: %w", err)
 	}
 
+	// Keep other run4ever processes from saving at the same time
+	lock, err := lockFile(jobsFile)
+	if err != nil {
+		return err
+	}
+	defer lock.unlock()
+
 	// Read existing jobs
 	jobs, err := loadJobDefinitions(jobsFile)
 	if err != nil && !os.IsNotExist(err) {
@@ -89,7 +146,7 @@ func RestoreJobs(verbose bool) error {
 	if err != nil {
 		if os.IsNotExist(err) {
 			if verbose {
-				fmt.Println("No saved jobs found")
+				fmt.Fprintln(os.Stderr, "No saved jobs found")
 			}
 			return nil
 		}
@@ -98,61 +155,22 @@ func RestoreJobs(verbose bool) error {
 
 	if len(jobs) == 0 {
 		if verbose {
-			fmt.Println("No jobs to restore")
+			fmt.Fprintln(os.Stderr, "No jobs to restore")
 		}
 		return nil
 	}
 
 	if verbose {
-		fmt.Printf("Restoring %d job(s)\n", len(jobs))
+		fmt.Fprintf(os.Stderr, "Restoring %d job(s)\n", len(jobs))
 	}
 
 	// Start each job in the background
 	for i, job := range jobs {
 		if verbose {
-			fmt.Printf("Restoring job %d: %v\n", i+1, job.Command)
-		}
-
-		// Build command arguments
-		args := []string{
-			"-g", // Run in background
-			"-d", fmt.Sprintf("%d", job.Delay),
-		}
-
-		if job.MaxRetries != -1 {
-			args = append(args, "-m", fmt.Sprintf("%d", job.MaxRetries))
-		}
-
-		if job.Timeout > 0 {
-			args = append(args, "-t", fmt.Sprintf("%d", job.Timeout))
+			fmt.Fprintf(os.Stderr, "Restoring job %d: %v\n", i+1, job.Command)
 		}
 
-		if job.NotifyOn != "" {
-			args = append(args, "--notify-on", job.NotifyOn)
-		}
-
-		if job.NotifyMethod != "" {
-			args = append(args, "--notify-method", job.NotifyMethod)
-		}
-
-		if job.TelegramToken != "" {
-			args = append(args, "--telegram-token", job.TelegramToken)
-		}
-
-		if job.TelegramChatID != "" {
-			args = append(args, "--telegram-chat-id", job.TelegramChatID)
-		}
-
-		if job.TelegramCustomAPI != "" {
-			args = append(args, "--telegram-custom-api", job.TelegramCustomAPI)
-		}
-
-		if job.ExitOnSuccess {
-			args = append(args, "--exit-on-success")
-		}
-
-		// Add command
-		args = append(args, job.Command...)
+		args := restoreArgs(job)
 
 		// Start run4ever in background for this job
 		cmd := exec.Command(os.Args[0], args...)
@@ -162,16 +180,126 @@ func RestoreJobs(verbose bool) error {
 
 		if err := cmd.Start(); err != nil {
 			if verbose {
-				fmt.Printf("Warning: failed to start job %d: %v\n", i+1, err)
+				fmt.Fprintf(os.Stderr, "Warning: failed to start job %d: %v\n", i+1, err)
 			}
+			events.error("restore_failed", "command", MaskOutput(strings.Join(job.Command, " ")), "error", err)
 			continue
 		}
+		events.info("job_restored", "command", MaskOutput(strings.Join(job.Command, " ")), "pid", cmd.Process.Pid)
 
 		if verbose {
-			fmt.Printf("Started job %d with PID: %d\n", i+1, cmd.Process.Pid)
+			fmt.Fprintf(os.Stderr, "Started job %d with PID: %d\n", i+1, cmd.Process.Pid)
 		}
 	}
 
 	return nil
 }
 
+// restoreArgs converts a saved job definition back into command line arguments
+func restoreArgs(job JobDefinition) []string {
+	// Build command arguments
+	args := []string{
+		"-g", // Run in background
+		"-d", fmt.Sprintf("%d", job.Delay),
+	}
+
+	if job.MaxRetries != -1 {
+		args = append(args, "-m", fmt.Sprintf("%d", job.MaxRetries))
+	}
+
+	if job.Timeout > 0 {
+		args = append(args, "-t", fmt.Sprintf("%d", job.Timeout))
+	}
+
+	if job.NotifyOn != "" {
+		args = append(args, "--notify-on", job.NotifyOn)
+	}
+
+	if job.NotifyMethod != "" {
+		args = append(args, "--notify-method", job.NotifyMethod)
+	}
+
+	if job.TelegramToken != "" {
+		args = append(args, "--telegram-token", job.TelegramToken)
+	}
+
+	if job.TelegramChatID != "" {
+		args = append(args, "--telegram-chat-id", job.TelegramChatID)
+	}
+
+	if job.TelegramCustomAPI != "" {
+		args = append(args, "--telegram-custom-api", job.TelegramCustomAPI)
+	}
+
+	if job.ExitOnSuccess {
+		args = append(args, "--exit-on-success")
+	}
+
+	// Flags that are not saved, such as -v or --persist, have no values
+	values := flagValues(job)
+	for _, name := range job.Flags {
+		for _, value := range values[name] {
+			args = append(args, "--"+name+"="+value)
+		}
+	}
+
+	// Add command
+	args = append(args, job.Command...)
+	return args
+}
+
+// flagValues returns the command line values of the settings saved after
+// ExitOnSuccess by flag name, one value per occurrence of the flag
+func flagValues(job JobDefinition) map[string][]string {
+	itoa := strconv.Itoa
+	btoa := strconv.FormatBool
+	return map[string][]string{
+		"name":                {job.Name},
+		"tag":                 job.Tags,
+		"backoff":             {job.Backoff.Mode},
+		"backoff-max":         {itoa(job.Backoff.Max)},
+		"backoff-multiplier":  {strconv.FormatFloat(job.Backoff.Multiplier, 'f', -1, 64)},
+		"backoff-jitter":      {job.Backoff.Jitter},
+		"backoff-reset":       {itoa(job.Backoff.ResetAfter)},
+		"schedule":            {job.Schedule},
+		"tz":                  {job.Timezone},
+		"missed-runs":         {job.MissedRuns},
+		"rate":                {btoa(job.Rate)},
+		"overlap":             {job.Overlap},
+		"max-concurrent":      {itoa(job.MaxConcurrent)},
+		"success-codes":       {formatExitCodes(job.SuccessCodes)},
+		"fatal-codes":         {formatExitCodes(job.FatalCodes)},
+		"timeout-signal":      {job.TimeoutSignal},
+		"kill-after":          {itoa(job.KillAfter)},
+		"forward-signals":     {strings.Join(job.ForwardSignals, ",")},
+		"stop-timeout":        {itoa(job.StopTimeout)},
+		"hup-restart":         {btoa(job.HUPRestart)},
+		"init":                {btoa(job.Init)},
+		"max-failures":        {itoa(job.MaxFailures)},
+		"failure-window":      {job.FailureWindow},
+		"reset-on-success":    {btoa(job.ResetOnSuccess)},
+		"breaker-failures":    {itoa(job.BreakerFailures)},
+		"cooldown":            {job.Cooldown},
+		"probe-cmd":           {job.ProbeCommand},
+		"log-dir":             {job.LogDir},
+		"log-max-size":        {itoa(job.LogMaxSize)},
+		"log-max-age":         {job.LogMaxAge},
+		"log-keep":            {itoa(job.LogKeep)},
+		"log-compress":        {btoa(job.LogCompress)},
+		"notify-output-lines": {itoa(job.NotifyOutputLines)},
+		"fail-on-output":      job.FailOnOutput,
+		"succeed-on-output":   job.SucceedOnOutput,
+		"history-dir":         {job.HistoryDir},
+		"history-max-runs":    {itoa(job.HistoryMaxRuns)},
+		"history-max-age":     {job.HistoryMaxAge},
+		"metrics-addr":        {job.MetricsAddr},
+		"health-addr":         {job.HealthAddr},
+		"ready-max-age":       {job.ReadyMaxAge},
+		"log-format":          {job.LogFormat},
+		"log-file":            {job.LogFile},
+		"prefix-output":       {btoa(job.PrefixOutput)},
+		"merge-output":        {btoa(job.MergeOutput)},
+		"stale-max-age":       {job.StaleMaxAge},
+		"archive-stale":       {btoa(job.ArchiveStale)},
+	}
+}
@@ -0,0 +1,62 @@
+package tools
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRestoreArgsKeepsZeroValues(t *testing.T) {
+	jobsFile := filepath.Join(t.TempDir(), "jobs.json")
+	saved := []JobDefinition{
+		{Command: []string{"sleep", "1"}, Delay: 10, MaxRetries: -1, Timeout: 5, Flags: []string{"forward-signals", "kill-after", "stop-timeout", "timeout"}},
+		{Command: []string{"sleep", "1"}, Delay: 10, MaxRetries: -1, Timeout: 5},
+	}
+	if err := saveJobDefinitions(jobsFile, saved); err != nil {
+		t.Fatalf("saveJobDefinitions() error: %v", err)
+	}
+	jobs, err := loadJobDefinitions(jobsFile)
+	if err != nil || len(jobs) != 2 {
+		t.Fatalf("loadJobDefinitions() = %v, %v", jobs, err)
+	}
+
+	args := strings.Join(restoreArgs(jobs[0]), " ")
+	for _, want := range []string{"--kill-after=0", "--forward-signals= ", "--stop-timeout=0"} {
+		if !strings.Contains(args, want) {
+			t.Errorf("restoreArgs() = %q, want it to contain %q", args, want)
+		}
+	}
+
+	// Jobs saved without the settings get the defaults
+	args = strings.Join(restoreArgs(jobs[1]), " ")
+	for _, flag := range []string{"--kill-after", "--forward-signals", "--stop-timeout"} {
+		if strings.Contains(args, flag) {
+			t.Errorf("restoreArgs() = %q, want no %s", args, flag)
+		}
+	}
+}
+
+func TestRestoreArgsNameAndTags(t *testing.T) {
+	args := strings.Join(restoreArgs(JobDefinition{Command: []string{"./backup.sh"}, MaxRetries: -1, Flags: []string{"name", "tag"}, Name: "backup", Tags: []string{"nightly", "db"}}), " ")
+	if !strings.Contains(args, "--name=backup --tag=nightly --tag=db") || !strings.HasSuffix(args, " ./backup.sh") {
+		t.Errorf("restoreArgs() = %q, want the name and both tags before the command", args)
+	}
+}
+
+func TestRestoreArgsOnlySetFlags(t *testing.T) {
+	job := JobDefinition{
+		Command:      []string{"./sync.sh"},
+		MaxRetries:   -1,
+		Flags:        []string{"backoff", "backoff-multiplier", "init", "stale-max-age", "archive-stale", "verbose"},
+		Backoff:      Backoff{Mode: "exponential", Max: 300, Multiplier: 1.5, Jitter: "full"},
+		Init:         true,
+		StaleMaxAge:  "0s",
+		ArchiveStale: true,
+		Cooldown:     "1m0s",
+	}
+	got := strings.Join(restoreArgs(job), " ")
+	want := "-g -d 0 --backoff=exponential --backoff-multiplier=1.5 --init=true --stale-max-age=0s --archive-stale=true ./sync.sh"
+	if got != want {
+		t.Errorf("restoreArgs() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,72 @@
+//go:build !windows
+
+package tools
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup starts the command in its own session so that it and all of
+// its descendants can be signalled as one process group
+func setProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setsid = true
+}
+
+// signalProcessGroup sends a signal to every process in the command's process group
+func signalProcessGroup(cmd *exec.Cmd, sig syscall.Signal) error {
+	if cmd.Process == nil {
+		return os.ErrProcessDone
+	}
+	err := syscall.Kill(-cmd.Process.Pid, sig)
+	if err == syscall.ESRCH {
+		return os.ErrProcessDone
+	}
+	return err
+}
+
+// signalProcess sends a signal to the process with the given PID
+func signalProcess(pid int, sig syscall.Signal) error {
+	if pid <= 0 {
+		return os.ErrProcessDone
+	}
+	err := syscall.Kill(pid, sig)
+	if err == syscall.ESRCH {
+		return os.ErrProcessDone
+	}
+	return err
+}
+
+// killProcessGroup sends SIGKILL to every process in a process group
+func killProcessGroup(pgid int) error {
+	if pgid <= 0 {
+		return os.ErrProcessDone
+	}
+	err := syscall.Kill(-pgid, syscall.SIGKILL)
+	if err == syscall.ESRCH {
+		return os.ErrProcessDone
+	}
+	return err
+}
+
+// processGroupExists reports whether any process is left in a process group
+func processGroupExists(pgid int) bool {
+	if pgid <= 0 {
+		return false
+	}
+	err := syscall.Kill(-pgid, 0)
+	return (err == nil || err == syscall.EPERM) && !processGroupZombie(pgid)
+}
+
+// processExists reports whether a process with the given PID exists
+func processExists(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
@@ -0,0 +1,129 @@
+//go:build linux
+
+package tools
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// spawnGrandchild is a shell script that starts a background sleep, records its PID and waits
+const spawnGrandchild = `sleep 30 & echo $! > "$PID_FILE"; wait`
+
+// processAlive reports whether a process exists and is not a zombie
+func processAlive(pid int) bool {
+	data, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return false
+	}
+	stat := string(data)
+	fields := strings.Fields(stat[strings.LastIndex(stat, ")")+1:])
+	return len(fields) > 0 && fields[0] != "Z"
+}
+
+// readPIDFile waits for the shell script to record the grandchild PID
+func readPIDFile(t *testing.T, pidFile string) int {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		data, err := os.ReadFile(pidFile)
+		if err == nil && strings.TrimSpace(string(data)) != "" {
+			pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+			if err != nil {
+				t.Fatalf("Invalid PID file content %q", data)
+			}
+			return pid
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatal("Timed out waiting for PID file")
+	return 0
+}
+
+// waitForExit waits briefly for a killed process to disappear
+func waitForExit(pid int) bool {
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if !processAlive(pid) {
+			return true
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return false
+}
+
+func TestRunWithTimeoutKillsProcessGroup(t *testing.T) {
+	pidFile := filepath.Join(t.TempDir(), "pid")
+	cmd := exec.Command("sh", "-c", spawnGrandchild)
+	cmd.Env = append(os.Environ(), "PID_FILE="+pidFile)
+
+	err := runWithTimeout(cmd, 1, TimeoutPolicy{Signal: syscall.SIGTERM, KillAfter: time.Second})
+	if err == nil {
+		t.Fatal("Expected command to time out")
+	}
+
+	pid := readPIDFile(t, pidFile)
+	if !waitForExit(pid) {
+		syscall.Kill(pid, syscall.SIGKILL)
+		t.Errorf("Grandchild process %d is still running after timeout", pid)
+	}
+}
+
+func TestKillRunningCommands(t *testing.T) {
+	pidFile := filepath.Join(t.TempDir(), "pid")
+	cmd := exec.Command("sh", "-c", spawnGrandchild)
+	cmd.Env = append(os.Environ(), "PID_FILE="+pidFile)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- runWithTimeout(cmd, 0, TimeoutPolicy{})
+	}()
+
+	pid := readPIDFile(t, pidFile)
+	KillRunningCommands()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Command did not exit after KillRunningCommands")
+	}
+	if !waitForExit(pid) {
+		syscall.Kill(pid, syscall.SIGKILL)
+		t.Errorf("Grandchild process %d is still running", pid)
+	}
+}
+
+// TestMaxRetriesKillsRunningCommands runs RunInfinitely in a subprocess. The first
+// run keeps a grandchild alive while the second run fails and exhausts the retries.
+func TestMaxRetriesKillsRunningCommands(t *testing.T) {
+	if os.Getenv("RUN4EVER_TEST_PGROUP") == "1" {
+		script := `n=$(cat "$COUNT_FILE" 2>/dev/null || echo 0); echo $((n+1)) > "$COUNT_FILE"; if [ "$n" -eq 0 ]; then ` + spawnGrandchild + `; else exit 1; fi`
+		RunInfinitely(1, 0, []string{"sh", "-c", script}, false, 1, "", "", "", "", "", false, "", "", "", "", "", 0,
+			RunOptions{Rate: true, Overlap: "concurrent", MaxConcurrent: 2})
+		return
+	}
+
+	dir := t.TempDir()
+	pidFile := filepath.Join(dir, "pid")
+	cmd := exec.Command(os.Args[0], "-test.run=^TestMaxRetriesKillsRunningCommands$")
+	cmd.Env = append(os.Environ(),
+		"RUN4EVER_TEST_PGROUP=1",
+		"PID_FILE="+pidFile,
+		"COUNT_FILE="+filepath.Join(dir, "count"),
+	)
+	if err := cmd.Run(); err == nil {
+		t.Fatal("Expected run4ever to exit with an error after max retries")
+	}
+
+	pid := readPIDFile(t, pidFile)
+	if !waitForExit(pid) {
+		syscall.Kill(pid, syscall.SIGKILL)
+		t.Errorf("Grandchild process %d is still running after max retries exit", pid)
+	}
+}
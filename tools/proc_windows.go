@@ -0,0 +1,60 @@
+//go:build windows
+
+package tools
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup is a no-op on Windows
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// signalProcessGroup signals the command itself, Windows only supports killing
+func signalProcessGroup(cmd *exec.Cmd, sig syscall.Signal) error {
+	if cmd.Process == nil {
+		return os.ErrProcessDone
+	}
+	if sig == syscall.SIGKILL {
+		return cmd.Process.Kill()
+	}
+	return cmd.Process.Signal(sig)
+}
+
+// signalProcess kills the process with the given PID, Windows only supports killing
+func signalProcess(pid int, sig syscall.Signal) error {
+	if sig != syscall.SIGKILL {
+		return fmt.Errorf("sending %s is not supported on Windows", signalName(sig))
+	}
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	defer p.Release()
+	return p.Kill()
+}
+
+// killProcessGroup kills the command itself, Windows commands have no process group
+func killProcessGroup(pgid int) error {
+	return signalProcess(pgid, syscall.SIGKILL)
+}
+
+// processGroupExists reports whether the command is still running
+func processGroupExists(pgid int) bool {
+	return processExists(pgid)
+}
+
+// processExists reports whether a process with the given PID exists
+func processExists(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	p.Release()
+	return true
+}
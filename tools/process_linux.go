@@ -0,0 +1,119 @@
+package tools
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// procStat holds the fields of /proc/<pid>/stat that run4ever uses
+type procStat struct {
+	pid       int
+	state     string
+	ppid      int
+	pgrp      int
+	startTime uint64 // clock ticks since boot
+}
+
+// zombie reports whether the process has exited but was not reaped yet
+func (s procStat) zombie() bool {
+	return s.state == "Z" || s.state == "X"
+}
+
+// readProcStat reads /proc/<pid>/stat
+func readProcStat(pid int) (procStat, error) {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return procStat{}, err
+	}
+	return parseProcStat(string(data))
+}
+
+// parseProcStat parses the content of /proc/<pid>/stat
+func parseProcStat(stat string) (procStat, error) {
+	malformed := fmt.Errorf("malformed process stat %q", stat)
+	// The command name in parentheses may contain spaces and parentheses itself
+	name := strings.IndexByte(stat, '(')
+	end := strings.LastIndexByte(stat, ')')
+	if name < 0 || end < name {
+		return procStat{}, malformed
+	}
+	// Fields after the name start with the state, field 3, so starttime (field 22) is at index 19
+	fields := strings.Fields(stat[end+1:])
+	if len(fields) < 20 {
+		return procStat{}, malformed
+	}
+	var s procStat
+	var err error
+	s.state = fields[0]
+	if s.pid, err = strconv.Atoi(strings.TrimSpace(stat[:name])); err != nil {
+		return procStat{}, malformed
+	}
+	if s.ppid, err = strconv.Atoi(fields[1]); err != nil {
+		return procStat{}, malformed
+	}
+	if s.pgrp, err = strconv.Atoi(fields[2]); err != nil {
+		return procStat{}, malformed
+	}
+	if s.startTime, err = strconv.ParseUint(fields[19], 10, 64); err != nil {
+		return procStat{}, malformed
+	}
+	return s, nil
+}
+
+// allProcStats reads the stat of every process, skipping those that exit meanwhile
+func allProcStats() []procStat {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil
+	}
+	var stats []procStat
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		if s, err := readProcStat(pid); err == nil {
+			stats = append(stats, s)
+		}
+	}
+	return stats
+}
+
+// processStartTime returns the start time of a process in clock ticks since boot,
+// which together with the PID identifies the process even after the PID is reused
+func processStartTime(pid int) (uint64, error) {
+	s, err := readProcStat(pid)
+	if err != nil {
+		return 0, err
+	}
+	return s.startTime, nil
+}
+
+// processZombie reports whether a process has exited but was not reaped yet
+func processZombie(pid int) bool {
+	s, err := readProcStat(pid)
+	return err == nil && s.zombie()
+}
+
+// processGroupZombie reports whether every process left in a process group has
+// exited but was not reaped yet
+func processGroupZombie(pgid int) bool {
+	for _, s := range allProcStats() {
+		if s.pgrp == pgid && !s.zombie() {
+			return false
+		}
+	}
+	return true
+}
+
+// processExecutable returns the path of the executable a process runs
+func processExecutable(pid int) (string, error) {
+	exe, err := os.Readlink(fmt.Sprintf("/proc/%d/exe", pid))
+	if err != nil {
+		return "", err
+	}
+	// The executable may have been replaced by an upgrade since the process started
+	return strings.TrimSuffix(exe, " (deleted)"), nil
+}
@@ -0,0 +1,95 @@
+package tools
+
+import (
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func TestParseProcStat(t *testing.T) {
+	tests := []struct {
+		name    string
+		stat    string
+		want    procStat
+		wantErr bool
+	}{
+		{"plain", "4242 (sleep) S 1 4242 4242 0 -1 4194560 97 0 0 0 0 0 0 0 20 0 1 0 987654 5599232 130 18446744073709551615", procStat{pid: 4242, state: "S", ppid: 1, pgrp: 4242, startTime: 987654}, false},
+		{"name with spaces and parentheses", "4242 (a) b (c) Z 17 4200 4200 0 -1 4194560 97 0 0 0 0 0 0 0 20 0 1 0 123 5599232", procStat{pid: 4242, state: "Z", ppid: 17, pgrp: 4200, startTime: 123}, false},
+		{"truncated", "4242 (sleep) S 1 4242", procStat{}, true},
+		{"no name", "garbage", procStat{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseProcStat(tt.stat)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("parseProcStat() = %+v, %v, want %+v (error %v)", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestIsJobRunning(t *testing.T) {
+	pid := os.Getpid()
+	start, err := processStartTime(pid)
+	if err != nil || start == 0 {
+		t.Fatalf("processStartTime() = %d, %v", start, err)
+	}
+	exe, err := processExecutable(pid)
+	if err != nil {
+		t.Fatalf("processExecutable() error: %v", err)
+	}
+
+	exited := exec.Command("true")
+	if err := exited.Run(); err != nil {
+		t.Fatalf("Failed to run true: %v", err)
+	}
+
+	// Not reaped until the test ends, so it stays a zombie
+	zombie := exec.Command("true")
+	if err := zombie.Start(); err != nil {
+		t.Fatalf("Failed to start true: %v", err)
+	}
+	defer zombie.Wait()
+	for deadline := time.Now().Add(5 * time.Second); !processZombie(zombie.Process.Pid); {
+		if time.Now().After(deadline) {
+			t.Fatal("true did not exit")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	tests := []struct {
+		name string
+		job  JobState
+		want bool
+	}{
+		{"same process", JobState{PID: pid, ProcessStart: start, Executable: exe}, true},
+		{"legacy entry without identity", JobState{PID: pid}, true},
+		{"reused PID", JobState{PID: pid, ProcessStart: start + 1, Executable: exe}, false},
+		{"other executable", JobState{PID: pid, ProcessStart: start, Executable: "/usr/bin/other"}, false},
+		{"exited process", JobState{PID: exited.Process.Pid}, false},
+		{"zombie process", JobState{PID: zombie.Process.Pid}, false},
+		{"invalid PID", JobState{PID: 0}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isJobRunning(tt.job); got != tt.want {
+				t.Errorf("isJobRunning(%+v) = %v, want %v", tt.job, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLogRecordsProcessIdentity(t *testing.T) {
+	logFile := setupTestLogFile(t)
+	InitStateFile(logFile)
+	LogWithFile("sleep", []string{"60"}, os.Getpid(), "job-1", "", logFile)
+
+	jobs, err := readStateFile(logFile)
+	if err != nil {
+		t.Fatalf("Failed to read state file: %v", err)
+	}
+	if len(jobs) != 1 || jobs[0].ProcessStart == 0 || jobs[0].Executable == "" || jobs[0].IsStale {
+		t.Errorf("Expected a running job with its process identity, got %+v", jobs)
+	}
+}
@@ -0,0 +1,27 @@
+//go:build !linux
+
+package tools
+
+import "errors"
+
+var errNoProcfs = errors.New("process details are only available on Linux")
+
+// processStartTime is only available on Linux, other systems rely on the PID alone
+func processStartTime(pid int) (uint64, error) {
+	return 0, errNoProcfs
+}
+
+// processZombie is only available on Linux
+func processZombie(pid int) bool {
+	return false
+}
+
+// processGroupZombie is only available on Linux
+func processGroupZombie(pgid int) bool {
+	return false
+}
+
+// processExecutable is only available on Linux
+func processExecutable(pid int) (string, error) {
+	return "", errNoProcfs
+}
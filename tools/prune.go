@@ -0,0 +1,118 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// PruneOptions selects the stale state entries removed by PruneStaleJobs
+type PruneOptions struct {
+	OlderThan time.Duration // only entries without activity for this long, 0 for all stale entries
+	Archive   bool          // append the removed entries to the state archive
+	DryRun    bool          // report the entries without removing them
+}
+
+// archivedJob is a state entry in the state archive
+type archivedJob struct {
+	JobState
+	ArchivedAt time.Time `json:"archived_at"`
+}
+
+// GetStateArchiveFile returns the path to the file that keeps pruned state entries
+func GetStateArchiveFile() string {
+	homeDir := os.Getenv("HOME")
+	return filepath.Join(homeDir, ".run4ever", "state-archive.jsonl")
+}
+
+// lastActivity returns when the job last showed signs of life
+func (j JobState) lastActivity() time.Time {
+	if j.LastRun.After(j.StartTime) {
+		return j.LastRun
+	}
+	return j.StartTime
+}
+
+// PruneStaleJobs removes the entries of jobs whose process is gone from the state
+// file and returns them
+func PruneStaleJobs(opts PruneOptions) ([]JobState, error) {
+	return pruneStaleJobs(GetStateFile(), GetStateArchiveFile(), opts, time.Now())
+}
+
+func pruneStaleJobs(stateFile string, archiveFile string, opts PruneOptions, now time.Time) ([]JobState, error) {
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+	lock, err := lockFile(stateFile)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.unlock()
+
+	jobs, err := readStateFile(stateFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var kept, pruned []JobState
+	for _, job := range jobs {
+		if job.IsStale && now.Sub(job.lastActivity()) >= opts.OlderThan {
+			pruned = append(pruned, job)
+		} else {
+			kept = append(kept, job)
+		}
+	}
+	if len(pruned) == 0 || opts.DryRun {
+		return pruned, nil
+	}
+
+	if opts.Archive {
+		if err := archiveJobs(archiveFile, pruned, now); err != nil {
+			return nil, err
+		}
+	}
+	if err := writeStateFile(stateFile, kept); err != nil {
+		return nil, err
+	}
+	return pruned, nil
+}
+
+// archiveJobs appends state entries to the archive file as JSON lines
+func archiveJobs(archiveFile string, jobs []JobState, now time.Time) error {
+	f, err := os.OpenFile(archiveFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open state archive: %w", err)
+	}
+	defer f.Close()
+
+	for _, job := range jobs {
+		data, err := json.Marshal(archivedJob{JobState: job, ArchivedAt: now})
+		if err != nil {
+			return fmt.Errorf("failed to marshal state entry: %w", err)
+		}
+		if _, err := f.Write(append(data, '\n')); err != nil {
+			return fmt.Errorf("failed to write state archive: %w", err)
+		}
+	}
+	return nil
+}
+
+// PrintPrunedJobs writes the pruned state entries as a table
+func PrintPrunedJobs(w io.Writer, jobs []JobState) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "JOB-ID\tPID\tSTATUS\tLAST-ACTIVITY\tCOMMAND")
+	for _, job := range jobs {
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\n",
+			job.JobID, job.PID, job.Status(),
+			job.lastActivity().Local().Format("2006-01-02 15:04:05"),
+			strings.TrimSpace(job.Command+" "+strings.Join(job.Args, " ")))
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,122 @@
+package tools
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPruneStaleJobs(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	jobs := []JobState{
+		{JobID: "running", PID: os.Getpid(), Command: "sleep", StartTime: now.Add(-72 * time.Hour)},
+		{JobID: "old-stale", PID: 1 << 30, Command: "sleep", StartTime: now.Add(-72 * time.Hour), IsStale: true},
+		{JobID: "recent-stale", PID: 1 << 30, Command: "sleep", StartTime: now.Add(-time.Hour), IsStale: true},
+		{JobID: "recent-run", PID: 1 << 30, Command: "sleep", StartTime: now.Add(-72 * time.Hour), LastRun: now.Add(-time.Hour), IsStale: true},
+	}
+
+	tests := []struct {
+		name       string
+		opts       PruneOptions
+		wantPruned []string
+		wantKept   []string
+	}{
+		{"all stale jobs", PruneOptions{}, []string{"old-stale", "recent-stale", "recent-run"}, []string{"running"}},
+		{"older than a day", PruneOptions{OlderThan: 24 * time.Hour}, []string{"old-stale"}, []string{"running", "recent-stale", "recent-run"}},
+		{"dry run", PruneOptions{DryRun: true}, []string{"old-stale", "recent-stale", "recent-run"}, []string{"running", "old-stale", "recent-stale", "recent-run"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			stateFile := filepath.Join(dir, "state.json")
+			archiveFile := filepath.Join(dir, "state-archive.jsonl")
+			if err := writeStateFile(stateFile, jobs); err != nil {
+				t.Fatalf("Failed to write state file: %v", err)
+			}
+
+			pruned, err := pruneStaleJobs(stateFile, archiveFile, tt.opts, now)
+			if err != nil {
+				t.Fatalf("pruneStaleJobs() error: %v", err)
+			}
+			if len(pruned) != len(tt.wantPruned) {
+				t.Errorf("pruned %d jobs, want %v", len(pruned), tt.wantPruned)
+			}
+			for _, jobID := range tt.wantPruned {
+				if !containsJob(pruned, jobID) {
+					t.Errorf("job %s was not pruned", jobID)
+				}
+			}
+
+			kept, err := readStateFile(stateFile)
+			if err != nil {
+				t.Fatalf("Failed to read state file: %v", err)
+			}
+			if len(kept) != len(tt.wantKept) {
+				t.Errorf("state file has %d jobs, want %v", len(kept), tt.wantKept)
+			}
+			for _, jobID := range tt.wantKept {
+				if !containsJob(kept, jobID) {
+					t.Errorf("job %s was removed", jobID)
+				}
+			}
+			if _, err := os.Stat(archiveFile); !os.IsNotExist(err) {
+				t.Errorf("archive was written without --archive")
+			}
+		})
+	}
+}
+
+func TestPruneStaleJobsArchive(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	dir := t.TempDir()
+	stateFile := filepath.Join(dir, "state.json")
+	archiveFile := filepath.Join(dir, "state-archive.jsonl")
+
+	// Two sweeps append to the same archive
+	for _, jobID := range []string{"first", "second"} {
+		stale := []JobState{{JobID: jobID, PID: 1 << 30, Command: "sleep", Args: []string{"60"}, StartTime: now.Add(-time.Hour), IsStale: true}}
+		if err := writeStateFile(stateFile, stale); err != nil {
+			t.Fatalf("Failed to write state file: %v", err)
+		}
+		if _, err := pruneStaleJobs(stateFile, archiveFile, PruneOptions{Archive: true}, now); err != nil {
+			t.Fatalf("pruneStaleJobs() error: %v", err)
+		}
+	}
+
+	f, err := os.Open(archiveFile)
+	if err != nil {
+		t.Fatalf("Failed to open archive: %v", err)
+	}
+	defer f.Close()
+	var archived []archivedJob
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var job archivedJob
+		if err := json.Unmarshal(scanner.Bytes(), &job); err != nil {
+			t.Fatalf("Invalid archive line %q: %v", scanner.Text(), err)
+		}
+		archived = append(archived, job)
+	}
+	if len(archived) != 2 || archived[0].JobID != "first" || archived[1].JobID != "second" {
+		t.Fatalf("Expected both jobs in the archive, got %+v", archived)
+	}
+	if !archived[1].ArchivedAt.Equal(now) || archived[1].Command != "sleep" || len(archived[1].Args) != 1 {
+		t.Errorf("Archived entry lost its fields: %+v", archived[1])
+	}
+}
+
+func TestWithoutStale(t *testing.T) {
+	jobs := []JobState{
+		{JobID: "running"},
+		{JobID: "stale", IsStale: true},
+		{JobID: "stopped-open", Breaker: "OPEN", IsStale: true},
+		{JobID: "open", Breaker: "OPEN"},
+	}
+	got := withoutStale(jobs)
+	if len(got) != 2 || !containsJob(got, "running") || !containsJob(got, "open") {
+		t.Errorf("withoutStale() = %+v, want running and open", got)
+	}
+}
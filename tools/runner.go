@@ -1,9 +1,14 @@
 package tools
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 )
 
@@ -19,7 +24,128 @@ var (
 	emailSMTPPort     int
 )
 
-func RunInfinitely(delayInt int, timeoutInt int, args []string, verbose bool, maxRetries int, notifyOn string, notifyMethod string, token string, chatID string, customAPI string, exitOnSuccess bool, slackWebhook string, emailToAddr string, emailFromAddr string, emailPass string, emailSMTP string, emailPort int) {
+var (
+	runningMutex    sync.Mutex
+	runningCommands = map[*exec.Cmd]bool{}
+)
+
+// RunOptions holds the optional run policies of RunInfinitely
+type RunOptions struct {
+	JobID         string
+	JobName       string // given with --name, labels metrics instead of the command's basename
+	Backoff       Backoff
+	Schedule      Schedule // when set, runs follow the schedule instead of the delay
+	MissedRuns    string   // skip, run-once or catch-up
+	Rate          bool     // measure the delay from start to start instead of end to start
+	Overlap       string   // skip, queue or concurrent, when a run outlasts the rate interval
+	MaxConcurrent int      // number of instances allowed at once with the concurrent overlap policy
+	ExitCodes     ExitCodes
+	TimeoutPolicy TimeoutPolicy
+	Signals       SignalConfig
+	InitMode      bool // reap orphaned processes and exit with the command's status, for use as PID 1
+	FailureBudget FailureBudget
+	Breaker       BreakerConfig
+	OutputLog     OutputLogConfig // where the output of each run is stored, disabled when Dir is empty
+
+	NotifyOutputLines int // number of output lines included in failure notifications
+	OutputMatchers    OutputMatchers
+	History           HistoryConfig // where a record of each run is stored, disabled when Dir is empty
+	PrefixOutput      bool          // prefix each output line with the time, run number and stream
+	MergeOutput       bool          // pass the command's stderr through to stdout
+}
+
+// TimeoutPolicy controls how a command that exceeds its timeout is stopped
+type TimeoutPolicy struct {
+	Signal    syscall.Signal // sent when the timeout expires, SIGKILL when zero
+	KillAfter time.Duration  // grace period before escalating to SIGKILL, 0 waits for the command to exit
+}
+
+// runResult describes the outcome of a single run
+type runResult struct {
+	run        int
+	start      time.Time
+	end        time.Time
+	exitStatus int
+	timedOut   bool
+	signal     string   // signal that ended the run, empty when it exited on its own
+	output     []string // last output lines, kept for notifications
+
+	matched     string // fail or succeed when an output pattern overrides the exit status
+	matchedLine string // output line that matched the pattern
+
+	// Bytes written to stdout and stderr, nil unless the output was captured
+	stdoutBytes *int64
+	stderrBytes *int64
+}
+
+// describe returns a suffix for messages explaining how the run ended
+func (res runResult) describe() string {
+	var details []string
+	switch {
+	case res.timedOut:
+		details = append(details, fmt.Sprintf("timed out, stopped with %s", res.signal))
+	case res.signal != "":
+		details = append(details, fmt.Sprintf("killed by %s", res.signal))
+	}
+	if res.matched != "" {
+		details = append(details, fmt.Sprintf("output matched --%s-on-output: %q", res.matched, MaskOutput(res.matchedLine)))
+	}
+	if len(details) == 0 {
+		return ""
+	}
+	return " (" + strings.Join(details, ", ") + ")"
+}
+
+// succeeded reports whether the run counts as a success. A matching output
+// pattern overrides the exit status.
+func (res runResult) succeeded(codes ExitCodes) bool {
+	switch res.matched {
+	case "fail":
+		return false
+	case "succeed":
+		return true
+	}
+	return codes.IsSuccess(res.exitStatus)
+}
+
+// fatal reports whether the run ended with a fatal exit status that was not
+// overridden by a --succeed-on-output match
+func (res runResult) fatal(codes ExitCodes) bool {
+	return res.matched != "succeed" && codes.IsFatal(res.exitStatus)
+}
+
+// timeoutError is returned by runWithTimeout when the command exceeded its timeout
+type timeoutError struct {
+	timeoutSeconds int
+	signal         syscall.Signal // last signal sent to the command
+}
+
+func (e *timeoutError) Error() string {
+	return fmt.Sprintf("command timed out after %d seconds, stopped with %s", e.timeoutSeconds, signalName(e.signal))
+}
+
+// runner holds the state shared by the runs of a RunInfinitely loop
+type runner struct {
+	args          []string
+	timeout       int
+	verbose       bool
+	maxRetries    int
+	notifyOn      string
+	notifyMethod  string
+	exitOnSuccess bool
+	opts          RunOptions
+	retryCount    int
+	lastStatus    int
+	backoff       *backoffState
+	failures      *failureWindow
+	outputLog     *outputLog
+	history       *historyStore
+	runs          int64 // number of runs started, updated atomically
+
+	consecutiveFailures int
+}
+
+func RunInfinitely(delayInt int, timeoutInt int, args []string, verbose bool, maxRetries int, notifyOn string, notifyMethod string, token string, chatID string, customAPI string, exitOnSuccess bool, slackWebhook string, emailToAddr string, emailFromAddr string, emailPass string, emailSMTP string, emailPort int, opts RunOptions) {
 	telegramToken = token
 	telegramChatID = chatID
 	telegramCustomAPI = customAPI
@@ -30,87 +156,481 @@ func RunInfinitely(delayInt int, timeoutInt int, args []string, verbose bool, ma
 	emailSMTPHost = emailSMTP
 	emailSMTPPort = emailPort
 
-	retryCount := 0
-	for {
-		exitStatus := 0
+	r := &runner{
+		args:          args,
+		timeout:       timeoutInt,
+		verbose:       verbose,
+		maxRetries:    maxRetries,
+		notifyOn:      notifyOn,
+		notifyMethod:  notifyMethod,
+		exitOnSuccess: exitOnSuccess,
+		opts:          opts,
+		backoff:       newBackoffState(opts.Backoff, time.Duration(delayInt)*time.Second),
+		failures:      newFailureWindow(opts.FailureBudget),
+	}
+	if opts.OutputLog.Dir != "" && opts.JobID != "" {
+		l, err := openOutputLog(opts.OutputLog, opts.JobID)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error opening output log, output will not be stored: %v\n", err)
+		} else {
+			r.outputLog = l
+		}
+	}
+	metrics.setJob(opts.JobID, opts.JobName, args)
+	if opts.JobID != "" {
+		reportStateError(UpdateDelay(opts.JobID, delayInt))
+	}
+	events.setJob(opts.JobID)
+	events.info("job_started", "command", MaskOutput(strings.Join(args, " ")), "pid", os.Getpid())
+	if opts.History.Dir != "" && opts.JobID != "" {
+		h, err := openHistoryStore(opts.History, opts.JobID)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error opening run history, runs will not be recorded: %v\n", err)
+		} else {
+			r.history = h
+		}
+	}
+	watchSignals(opts.Signals)
+	if opts.InitMode {
+		startReaper(verbose)
+	}
 
-		if maxRetries != -1 && retryCount >= maxRetries {
-			if verbose {
-				fmt.Println("Max retries reached, exiting")
-			}
-			os.Exit(1)
+	if opts.Schedule != nil {
+		r.runScheduled()
+	}
+	if opts.Rate {
+		r.runAtRate(time.Duration(delayInt) * time.Second)
+	}
+
+	for {
+		r.checkRetries()
+		if !r.finish(r.execute()) {
+			continue
 		}
 
-		cmd := exec.Command(args[0], args[1:]...)
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-		cmd.Stdin = os.Stdin
+		sleep := r.backoff.next()
+		if verbose {
+			fmt.Fprintf(os.Stderr, "Sleeping for %s\n", sleep)
+		}
+		events.info("sleeping", "duration_ms", sleep.Milliseconds())
+		sleepOrWake(sleep)
+	}
+}
 
-		// Set up timeout if specified
-		var err error
-		if timeoutInt > 0 {
-			if verbose {
-				fmt.Printf("Running command with timeout: %d seconds\n", timeoutInt)
-			}
-			err = runWithTimeout(cmd, timeoutInt)
-		} else {
-			err = cmd.Run()
+// runScheduled runs the command at the fire times of the schedule
+func (r *runner) runScheduled() {
+	schedule := newScheduleState(r.opts.Schedule, r.opts.MissedRuns, time.Now())
+	if !waitForSchedule(schedule.next, r.opts.JobID, r.verbose) {
+		r.exit(0)
+	}
+	for {
+		r.checkRetries()
+		if !r.finish(r.execute()) {
+			continue
+		}
+		if !waitForSchedule(schedule.advance(time.Now()), r.opts.JobID, r.verbose) {
+			r.exit(0)
 		}
+	}
+}
 
-		if err != nil {
-			if verbose {
-				fmt.Println(err)
+// runAtRate starts a run every interval regardless of how long the previous one took.
+// When a run is still in progress at the next tick the overlap policy decides whether
+// the tick is skipped, queued until the run finishes, or started concurrently.
+func (r *runner) runAtRate(interval time.Duration) {
+	limit := 1
+	if r.opts.Overlap == "concurrent" && r.opts.MaxConcurrent > 1 {
+		limit = r.opts.MaxConcurrent
+	}
+
+	results := make(chan runResult)
+	running := 0
+	queued := false
+	start := func() {
+		r.checkRetries()
+		running++
+		go func() {
+			results <- r.execute()
+		}()
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	start()
+	for {
+		select {
+		case <-ticker.C:
+			switch {
+			case running < limit:
+				start()
+			case r.opts.Overlap == "queue":
+				if r.verbose && !queued {
+					fmt.Fprintln(os.Stderr, "Previous run still in progress, queueing the next run")
+				}
+				queued = true
+			default:
+				if r.verbose {
+					fmt.Fprintln(os.Stderr, "Previous run still in progress, skipping this tick")
+				}
 			}
-			if cmd.ProcessState != nil {
-				exitStatus = cmd.ProcessState.ExitCode()
-			} else {
-				// Command was killed due to timeout
-				exitStatus = 124 // Standard timeout exit code
+		case res := <-results:
+			running--
+			if _, ok := stopRequested(); ok {
+				if running == 0 {
+					r.finish(res)
+				} else {
+					r.recordRun(res)
+				}
+				continue
 			}
-			retryCount++
-		}
-
-		// Handle exit-on-success: if command succeeded, exit
-		if exitOnSuccess && exitStatus == 0 {
-			if shouldNotify(notifyOn, exitStatus) {
-				title := "run4ever: Task " + statusToString(exitStatus)
-				maskedArgs := MaskPassword(args)
-				message := fmt.Sprintf("Command %s %s exited with status %d", args[0], maskedArgs, exitStatus)
-				if verbose {
-					fmt.Printf("Sending notification\nTitle: %s\nMessage: %s\n", title, message)
+			if takeRestart() {
+				r.recordRun(res)
+				if r.verbose {
+					fmt.Fprintln(os.Stderr, "Restarting command")
+				}
+				if running < limit {
+					start()
 				}
-				doNotify(notifyOn, notifyMethod, verbose, title, message)
+				continue
+			}
+			r.handleResult(res)
+			if queued && running < limit {
+				queued = false
+				start()
 			}
-			if verbose {
-				fmt.Printf("Command `%s` succeeded, exiting as requested\n", args[0])
+		case <-wakeChan:
+			if running < limit {
+				start()
 			}
-			os.Exit(0)
 		}
+	}
+}
+
+// finish handles the result of a run. When run4ever is stopping it exits with the
+// status of the run, and when the run was stopped for a restart it returns false
+// so that a fresh run starts without counting the interrupted one.
+func (r *runner) finish(res runResult) bool {
+	if _, ok := stopRequested(); ok {
+		r.recordRun(res)
+		if r.verbose {
+			fmt.Fprintf(os.Stderr, "Command `%s` stopped with status %d, exiting\n", r.args[0], res.exitStatus)
+		}
+		events.info("job_exiting", "reason", "stopped by signal", "exit_code", res.exitStatus)
+		r.closeOutputLog()
+		exitOnSignal(res.exitStatus)
+	}
+	if takeRestart() {
+		r.recordRun(res)
+		if r.verbose {
+			fmt.Fprintln(os.Stderr, "Restarting command")
+		}
+		return false
+	}
+	r.handleResult(res)
+	return true
+}
+
+// checkRetries exits when the maximum number of retries has been reached
+func (r *runner) checkRetries() {
+	if r.maxRetries != -1 && r.retryCount >= r.maxRetries {
+		if r.verbose {
+			fmt.Fprintln(os.Stderr, "Max retries reached, exiting")
+		}
+		events.warn("job_exiting", "reason", "max retries reached", "retries", r.retryCount)
+		if r.opts.InitMode {
+			// Report the command's own status to the container runtime
+			r.exit(r.lastStatus)
+		}
+		r.exit(1)
+	}
+}
+
+// execute runs the command once and returns how it ended
+func (r *runner) execute() runResult {
+	stdout, stderr := r.terminal()
+	cmd := exec.Command(r.args[0], r.args[1:]...)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	cmd.Stdin = os.Stdin
+
+	run := int(atomic.AddInt64(&r.runs, 1))
+	start := time.Now()
+	events.info("run_started", "run", run)
+	var sinks []lineSink
+	if r.outputLog != nil {
+		r.outputLog.beginRun(run, start)
+		sinks = append(sinks, runLogSink{log: r.outputLog, run: run})
+	}
+	var tail *outputTail
+	if r.opts.NotifyOutputLines > 0 && r.notifyOn != "" {
+		tail = newOutputTail(r.opts.NotifyOutputLines)
+		sinks = append(sinks, tail)
+	}
+	var match *outputMatch
+	if r.opts.OutputMatchers.enabled() {
+		match = &outputMatch{matchers: r.opts.OutputMatchers}
+		sinks = append(sinks, match)
+	}
+	if r.opts.PrefixOutput {
+		sinks = append(sinks, prefixSink{run: run, stdout: stdout, stderr: stderr})
+	}
+	// Output is only piped through run4ever when something reads it, so that the
+	// command otherwise keeps run4ever's terminal
+	if len(sinks) == 0 {
+		res := r.wait(cmd)
+		res.run, res.start, res.end = run, start, time.Now()
+		return res
+	}
 
-		if shouldNotify(notifyOn, exitStatus) {
-			title := "run4ever: Task " + statusToString(exitStatus)
-			maskedArgs := MaskPassword(args)
-			message := fmt.Sprintf("Command %s %s exited with status %d", args[0], maskedArgs, exitStatus)
-			if verbose {
-				fmt.Printf("Sending notification\nTitle: %s\nMessage: %s\n", title, message)
+	capture := newOutputCapture(sinks...)
+	capture.stdout, capture.stderr = stdout, stderr
+	if r.opts.PrefixOutput {
+		// The prefix sink writes the lines instead
+		capture.stdout, capture.stderr = nil, nil
+	}
+	if err := capture.attach(cmd); err != nil {
+		fmt.Fprintf(os.Stderr, "Error capturing output of run %d: %v\n", run, err)
+		cmd.Stdout = stdout
+		cmd.Stderr = stderr
+	}
+	res := r.wait(cmd)
+	capture.finish()
+	res.run, res.start, res.end = run, start, time.Now()
+	stdoutBytes, stderrBytes := capture.byteCount("stdout"), capture.byteCount("stderr")
+	res.stdoutBytes, res.stderrBytes = &stdoutBytes, &stderrBytes
+	if tail != nil {
+		res.output = tail.snapshot()
+	}
+	if match != nil {
+		match.apply(&res)
+	}
+	if r.outputLog != nil {
+		r.outputLog.endRun(run, res)
+	}
+	return res
+}
+
+// terminal returns where the output of the command is passed through
+func (r *runner) terminal() (stdout *os.File, stderr *os.File) {
+	if r.opts.MergeOutput {
+		return os.Stdout, os.Stdout
+	}
+	return os.Stdout, os.Stderr
+}
+
+// wait runs a prepared command with the configured timeout and returns how it ended
+func (r *runner) wait(cmd *exec.Cmd) runResult {
+	if r.timeout > 0 && r.verbose {
+		fmt.Fprintf(os.Stderr, "Running command with timeout: %d seconds\n", r.timeout)
+	}
+	err := runWithTimeout(cmd, r.timeout, r.opts.TimeoutPolicy)
+
+	var res runResult
+	if err == nil {
+		return res
+	}
+	if r.verbose {
+		fmt.Fprintln(os.Stderr, err)
+	}
+
+	var te *timeoutError
+	switch {
+	case errors.Is(err, errStopping):
+		sig, _ := stopRequested()
+		res.exitStatus = 128 + int(sig)
+	case errors.As(err, &te):
+		events.warn("timeout", "timeout_seconds", te.timeoutSeconds, "signal", signalName(te.signal))
+		res.timedOut = true
+		res.signal = signalName(te.signal)
+		res.exitStatus = 124 // Standard timeout exit code
+		if te.signal == syscall.SIGKILL {
+			res.exitStatus = 128 + int(syscall.SIGKILL)
+		}
+	case cmd.ProcessState != nil:
+		res.exitStatus = cmd.ProcessState.ExitCode()
+		if sig, ok := exitSignal(cmd.ProcessState); ok {
+			res.exitStatus = 128 + int(sig)
+			res.signal = signalName(sig)
+		}
+	default:
+		// Command could not be started
+		res.exitStatus = 127
+	}
+	return res
+}
+
+// handleResult counts retries, sends notifications and exits when requested
+func (r *runner) handleResult(res runResult) {
+	exitStatus := res.exitStatus
+	r.lastStatus = exitStatus
+	codes := r.opts.ExitCodes
+	success := res.succeeded(codes)
+	if !success {
+		r.retryCount++
+	}
+	r.backoff.record(success)
+	r.recordRun(res)
+
+	if res.fatal(codes) {
+		if shouldNotify(r.notifyOn, false) {
+			title := "run4ever: Task " + statusToString(false, true)
+			maskedArgs := MaskPassword(r.args)
+			message := fmt.Sprintf("Command %s %s exited with fatal status %d%s, giving up", r.args[0], maskedArgs, exitStatus, res.describe())
+			message = withOutputTail(message, res.output, r.notifyMethod)
+			if r.verbose {
+				fmt.Fprintf(os.Stderr, "Sending notification\nTitle: %s\nMessage: %s\n", title, message)
 			}
-			doNotify(notifyOn, notifyMethod, verbose, title, message)
+			doNotify(r.notifyOn, r.notifyMethod, r.verbose, title, message)
+		}
+		if r.verbose {
+			fmt.Fprintf(os.Stderr, "Command `%s` exited with fatal status %d, exiting\n", r.args[0], exitStatus)
+		}
+		events.error("job_exiting", "reason", "fatal exit status", "exit_code", exitStatus)
+		r.exit(exitStatus)
+	}
+
+	if shouldNotify(r.notifyOn, success) {
+		title := "run4ever: Task " + statusToString(success, false)
+		maskedArgs := MaskPassword(r.args)
+		message := fmt.Sprintf("Command %s %s exited with status %d%s", r.args[0], maskedArgs, exitStatus, res.describe())
+		if !success {
+			message = withOutputTail(message, res.output, r.notifyMethod)
 		}
+		if r.verbose {
+			fmt.Fprintf(os.Stderr, "Sending notification\nTitle: %s\nMessage: %s\n", title, message)
+		}
+		doNotify(r.notifyOn, r.notifyMethod, r.verbose, title, message)
+	}
+
+	// Handle exit-on-success: if command succeeded, exit
+	if r.exitOnSuccess && success {
+		if r.verbose {
+			fmt.Fprintf(os.Stderr, "Command `%s` succeeded, exiting as requested\n", r.args[0])
+		}
+		events.info("job_exiting", "reason", "succeeded with --exit-on-success", "exit_code", 0)
+		r.exit(0)
+	}
+
+	if r.verbose {
+		fmt.Fprintf(os.Stderr, "Command `%s` exited with status %d%s\n", r.args[0], exitStatus, res.describe())
+	}
+
+	if success {
+		r.consecutiveFailures = 0
+	} else {
+		r.consecutiveFailures++
+	}
+	if r.failures.record(success, time.Now()) {
+		r.openBreaker(r.failures.describe())
+	} else if r.opts.Breaker.Failures > 0 && r.consecutiveFailures >= r.opts.Breaker.Failures {
+		r.openBreaker(fmt.Sprintf("%d consecutive failures", r.consecutiveFailures))
+	}
+}
+
+// recordRun adds a finished run to the metrics, the state file and the job's history
+func (r *runner) recordRun(res runResult) {
+	success := res.succeeded(r.opts.ExitCodes)
+	metrics.observeRun(res, success, r.retryCount)
+	fields := []interface{}{
+		"run", res.run,
+		"exit_code", res.exitStatus,
+		"duration_ms", res.end.Sub(res.start).Milliseconds(),
+		"success", success,
+	}
+	if res.signal != "" {
+		fields = append(fields, "signal", res.signal)
+	}
+	if res.timedOut {
+		fields = append(fields, "timed_out", true)
+	}
+	if res.matched != "" {
+		fields = append(fields, "matched", res.matched, "matched_line", MaskOutput(res.matchedLine))
+	}
+	if success {
+		events.info("run_finished", fields...)
+	} else {
+		events.warn("run_finished", fields...)
+	}
+	if r.opts.JobID != "" {
+		reportStateError(UpdateLastRun(r.opts.JobID, res.exitStatus, res.end, r.retryCount))
+	}
+	if r.history == nil {
+		return
+	}
+	rec := RunRecord{
+		JobID:       r.opts.JobID,
+		Run:         res.run,
+		Command:     MaskOutput(strings.Join(r.args, " ")),
+		Start:       res.start,
+		End:         res.end,
+		DurationMS:  res.end.Sub(res.start).Milliseconds(),
+		ExitCode:    res.exitStatus,
+		Signal:      res.signal,
+		TimedOut:    res.timedOut,
+		Success:     success,
+		Retries:     r.retryCount,
+		StdoutBytes: res.stdoutBytes,
+		StderrBytes: res.stderrBytes,
+		Matched:     res.matched,
+		MatchedLine: MaskOutput(res.matchedLine),
+	}
+	if err := r.history.append(rec); err != nil {
+		fmt.Fprintf(os.Stderr, "Error recording run %d: %v\n", res.run, err)
+	}
+}
+
+// ValidateOverlap checks the overlap policy name used with the rate mode
+func ValidateOverlap(policy string) error {
+	switch policy {
+	case "", "skip", "queue", "concurrent":
+		return nil
+	}
+	return fmt.Errorf("invalid overlap policy %q, expected skip, queue or concurrent", policy)
+}
+
+// reportStateError shows a failed update of the job's state entry, the job keeps
+// running without it
+func reportStateError(err error) {
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error updating job state: %v\n", err)
+	}
+}
+
+// waitForSchedule records the next fire time in the state file and sleeps until
+// it. It returns false when the schedule has no more runs.
+func waitForSchedule(next time.Time, jobID string, verbose bool) bool {
+	if next.IsZero() {
 		if verbose {
-			fmt.Printf("Command `%s` exited with status %d\n", args[0], exitStatus)
-			fmt.Printf("Sleeping for %d seconds\n", delayInt)
+			fmt.Fprintln(os.Stderr, "No more scheduled runs, exiting")
 		}
-		time.Sleep(time.Duration(delayInt) * time.Second)
+		events.info("job_exiting", "reason", "no more scheduled runs", "exit_code", 0)
+		return false
+	}
+	if jobID != "" {
+		reportStateError(UpdateNextRun(jobID, next))
+	}
+	if verbose {
+		fmt.Fprintf(os.Stderr, "Next run at %s\n", next.Format(time.RFC3339))
 	}
+	events.info("sleeping", "duration_ms", time.Until(next).Milliseconds(), "next_run", next)
+	sleepOrWake(time.Until(next))
+	return true
 }
 
-// runWithTimeout runs a command with a timeout
-func runWithTimeout(cmd *exec.Cmd, timeoutSeconds int) error {
+// runWithTimeout runs a command in its own process group with a timeout. When
+// the timeout expires the group receives the policy signal, and SIGKILL if the
+// command is still running after the grace period. A timeout of 0 waits for
+// the command without a limit.
+func runWithTimeout(cmd *exec.Cmd, timeoutSeconds int, policy TimeoutPolicy) error {
+	setProcessGroup(cmd)
+
 	// Start the command
-	err := cmd.Start()
+	err := startCommand(cmd)
 	if err != nil {
 		return err
 	}
+	defer untrackCommand(cmd)
 
 	// Create a channel to signal when the command completes
 	done := make(chan error, 1)
@@ -118,56 +638,172 @@ func runWithTimeout(cmd *exec.Cmd, timeoutSeconds int) error {
 		done <- cmd.Wait()
 	}()
 
+	if timeoutSeconds <= 0 {
+		return <-done
+	}
+
 	// Wait for either completion or timeout
 	select {
 	case err := <-done:
 		return err
 	case <-time.After(time.Duration(timeoutSeconds) * time.Second):
-		// Timeout occurred, kill the process
-		if err := cmd.Process.Kill(); err != nil {
-			return fmt.Errorf("failed to kill process after timeout: %w", err)
+	}
+
+	sig := policy.Signal
+	if sig == 0 {
+		sig = syscall.SIGKILL
+	}
+	if err := signalProcessGroup(cmd, sig); err != nil && !errors.Is(err, os.ErrProcessDone) {
+		return fmt.Errorf("failed to signal process after timeout: %w", err)
+	}
+
+	if sig != syscall.SIGKILL {
+		var grace <-chan time.Time
+		if policy.KillAfter > 0 {
+			grace = time.After(policy.KillAfter)
+		}
+		select {
+		case <-done:
+		case <-grace:
+			// Still alive after the grace period, kill the process
+			if err := signalProcessGroup(cmd, syscall.SIGKILL); err != nil && !errors.Is(err, os.ErrProcessDone) {
+				return fmt.Errorf("failed to kill process after timeout: %w", err)
+			}
+			sig = syscall.SIGKILL
+			<-done
+		}
+	} else {
+		<-done
+	}
+
+	// Make sure no descendant outlives the timed out command
+	signalProcessGroup(cmd, syscall.SIGKILL)
+	return &timeoutError{timeoutSeconds: timeoutSeconds, signal: sig}
+}
+
+// startCommand starts a command and tracks it so that signals can reach it.
+// No new command is started once run4ever is stopping.
+func startCommand(cmd *exec.Cmd) error {
+	runningMutex.Lock()
+	defer runningMutex.Unlock()
+	if stopSignal != 0 {
+		return errStopping
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	runningCommands[cmd] = true
+	return nil
+}
+
+// isTrackedPID reports whether pid belongs to a command started by RunInfinitely
+func isTrackedPID(pid int) bool {
+	runningMutex.Lock()
+	defer runningMutex.Unlock()
+	for cmd := range runningCommands {
+		if cmd.Process != nil && cmd.Process.Pid == pid {
+			return true
 		}
-		return fmt.Errorf("command timed out after %d seconds", timeoutSeconds)
+	}
+	return false
+}
+
+func untrackCommand(cmd *exec.Cmd) {
+	runningMutex.Lock()
+	defer runningMutex.Unlock()
+	delete(runningCommands, cmd)
+}
+
+// KillRunningCommands kills the process groups of all commands started by RunInfinitely
+func KillRunningCommands() {
+	runningMutex.Lock()
+	defer runningMutex.Unlock()
+	for cmd := range runningCommands {
+		signalProcessGroup(cmd, syscall.SIGKILL)
+	}
+}
+
+// runningProcessGroups returns the process groups of all commands started by
+// RunInfinitely. The commands are not reaped yet, so their PIDs are not reused.
+func runningProcessGroups() []ProcessGroup {
+	runningMutex.Lock()
+	defer runningMutex.Unlock()
+	var groups []ProcessGroup
+	for cmd := range runningCommands {
+		group := ProcessGroup{PGID: cmd.Process.Pid}
+		group.Start, _ = processStartTime(group.PGID)
+		groups = append(groups, group)
+	}
+	return groups
+}
+
+// exit kills any runs still in progress and exits with the given code
+func (r *runner) exit(code int) {
+	KillRunningCommands()
+	r.closeOutputLog()
+	os.Exit(code)
+}
+
+// closeOutputLog closes the output log before run4ever exits
+func (r *runner) closeOutputLog() {
+	if r.outputLog != nil {
+		r.outputLog.close()
 	}
 }
 
 func doNotify(notifyOn string, notifyMethod string, verbose bool, title string, message string) {
+	var err error
 	switch notifyMethod {
 	case "desktop":
-		if err := SendDesktopNotification(title, message, verbose); err != nil && verbose {
-			fmt.Println("Error sending desktop notification: ", err)
+		if err = SendDesktopNotification(title, message, verbose); err != nil && verbose {
+			fmt.Fprintln(os.Stderr, "Error sending desktop notification: ", err)
 		}
 	case "telegram":
-		if err := SendTelegramNotification(telegramToken, telegramChatID, message, telegramCustomAPI, verbose); err != nil && verbose {
-			fmt.Println("Error sending Telegram notification: ", err)
+		if err = SendTelegramNotification(telegramToken, telegramChatID, message, telegramCustomAPI, verbose); err != nil && verbose {
+			fmt.Fprintln(os.Stderr, "Error sending Telegram notification: ", err)
 		}
 	case "slack":
-		if err := SendSlackNotification(slackWebhookURL, message, verbose); err != nil && verbose {
-			fmt.Println("Error sending Slack notification: ", err)
+		if err = SendSlackNotification(slackWebhookURL, message, verbose); err != nil && verbose {
+			fmt.Fprintln(os.Stderr, "Error sending Slack notification: ", err)
 		}
 	case "email":
-		if err := SendEmailNotification(emailTo, emailFrom, emailPassword, emailSMTPHost, emailSMTPPort, title, message, verbose); err != nil && verbose {
-			fmt.Println("Error sending email notification: ", err)
+		if err = SendEmailNotification(emailTo, emailFrom, emailPassword, emailSMTPHost, emailSMTPPort, title, message, verbose); err != nil && verbose {
+			fmt.Fprintln(os.Stderr, "Error sending email notification: ", err)
+		}
+	default:
+		err = fmt.Errorf("unknown notification method %q", notifyMethod)
+		if verbose {
+			fmt.Fprintln(os.Stderr, "Error sending notification: ", err)
 		}
 	}
+	if err != nil {
+		metrics.notifyFailed(notifyMethod)
+		events.error("notification_failed", "method", notifyMethod, "title", title, "error", err)
+	} else {
+		events.info("notification_sent", "method", notifyMethod, "title", title)
+	}
 }
 
-func shouldNotify(notifyOn string, exitStatus int) bool {
+// shouldNotify reports whether a run with the given verdict is notified
+func shouldNotify(notifyOn string, success bool) bool {
 	switch notifyOn {
 	case "always":
 		return true
 	case "success":
-		return exitStatus == 0
+		return success
 	case "failure":
-		return exitStatus != 0
+		return !success
 	default:
 		return false
 	}
 }
 
-func statusToString(exitStatus int) string {
-	if exitStatus == 0 {
+func statusToString(success bool, fatal bool) string {
+	if success {
 		return "Success"
 	}
+	if fatal {
+		return "Fatal"
+	}
 	return "Failure"
 }
@@ -1,8 +1,10 @@
 package tools
 
 import (
+	"os"
 	"os/exec"
 	"strings"
+	"syscall"
 	"testing"
 	"time"
 )
@@ -62,7 +64,7 @@ func TestRunWithTimeout(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			cmd := exec.Command(tt.command[0], tt.command[1:]...)
 			start := time.Now()
-			err := runWithTimeout(cmd, tt.timeoutSeconds)
+			err := runWithTimeout(cmd, tt.timeoutSeconds, TimeoutPolicy{})
 			duration := time.Since(start)
 
 			if tt.shouldTimeout {
@@ -87,7 +89,7 @@ func TestRunWithTimeout(t *testing.T) {
 func TestRunWithTimeoutKillProcess(t *testing.T) {
 	// Use a command that will definitely timeout
 	cmd := exec.Command("sleep", "10")
-	err := runWithTimeout(cmd, 1)
+	err := runWithTimeout(cmd, 1, TimeoutPolicy{})
 	if err == nil {
 		t.Error("Expected command to timeout and return error")
 	}
@@ -101,3 +103,115 @@ func TestRunWithTimeoutKillProcess(t *testing.T) {
 		t.Errorf("Expected timeout error, got: %v", err)
 	}
 }
+
+// TestRunWithTimeoutEscalation tests the grace period between the timeout signal and SIGKILL
+func TestRunWithTimeoutEscalation(t *testing.T) {
+	tests := []struct {
+		name       string
+		command    []string
+		policy     TimeoutPolicy
+		wantSignal syscall.Signal
+		exitStatus int
+	}{
+		{
+			name:       "command stops on SIGTERM",
+			command:    []string{"sleep", "10"},
+			policy:     TimeoutPolicy{Signal: syscall.SIGTERM, KillAfter: 5 * time.Second},
+			wantSignal: syscall.SIGTERM,
+			exitStatus: 124,
+		},
+		{
+			name:       "command ignoring SIGTERM is killed",
+			command:    []string{"sh", "-c", "trap '' TERM; sleep 10"},
+			policy:     TimeoutPolicy{Signal: syscall.SIGTERM, KillAfter: 500 * time.Millisecond},
+			wantSignal: syscall.SIGKILL,
+			exitStatus: 137,
+		},
+		{
+			name:       "default policy kills immediately",
+			command:    []string{"sleep", "10"},
+			wantSignal: syscall.SIGKILL,
+			exitStatus: 137,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Now()
+			r := &runner{args: tt.command, timeout: 1, opts: RunOptions{TimeoutPolicy: tt.policy}}
+			res := r.execute()
+			if time.Since(start) > 3*time.Second {
+				t.Errorf("Command was not stopped in time, took %v", time.Since(start))
+			}
+			if !res.timedOut {
+				t.Fatal("Expected run to be reported as timed out")
+			}
+			if res.signal != signalName(tt.wantSignal) {
+				t.Errorf("Stopped with %s, want %s", res.signal, signalName(tt.wantSignal))
+			}
+			if res.exitStatus != tt.exitStatus {
+				t.Errorf("Exit status %d, want %d", res.exitStatus, tt.exitStatus)
+			}
+		})
+	}
+}
+
+func TestExecuteExitStatus(t *testing.T) {
+	tests := []struct {
+		name       string
+		command    []string
+		exitStatus int
+		signal     string
+	}{
+		{"success", []string{"true"}, 0, ""},
+		{"failure", []string{"sh", "-c", "exit 3"}, 3, ""},
+		{"killed by signal", []string{"sh", "-c", "kill -TERM $$"}, 143, "SIGTERM"},
+		{"command not found", []string{"run4ever-no-such-command"}, 127, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &runner{args: tt.command}
+			res := r.execute()
+			if res.exitStatus != tt.exitStatus || res.signal != tt.signal {
+				t.Errorf("execute() = %+v, want exit status %d and signal %q", res, tt.exitStatus, tt.signal)
+			}
+		})
+	}
+}
+
+func TestValidateOverlap(t *testing.T) {
+	for _, policy := range []string{"", "skip", "queue", "concurrent"} {
+		if err := ValidateOverlap(policy); err != nil {
+			t.Errorf("ValidateOverlap(%q) unexpected error: %v", policy, err)
+		}
+	}
+	if err := ValidateOverlap("parallel"); err == nil {
+		t.Error("Expected error for unknown overlap policy")
+	}
+}
+
+// TestRunAtRate runs RunInfinitely in a subprocess because it exits the process
+// once the maximum number of retries is reached
+func TestRunAtRate(t *testing.T) {
+	if os.Getenv("RUN4EVER_TEST_RATE") == "1" {
+		RunInfinitely(1, 0, []string{"sh", "-c", "sleep 0.5; exit 1"}, false, 3, "", "", "", "", "", false, "", "", "", "", "", 0,
+			RunOptions{Rate: true, Overlap: "skip"})
+		return
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestRunAtRate$")
+	cmd.Env = append(os.Environ(), "RUN4EVER_TEST_RATE=1")
+	start := time.Now()
+	err := cmd.Run()
+	elapsed := time.Since(start)
+
+	if exitErr, ok := err.(*exec.ExitError); !ok || exitErr.ExitCode() != 1 {
+		t.Fatalf("Expected exit status 1 after max retries, got %v", err)
+	}
+	// Runs start at 0s, 1s and 2s and the loop gives up at the 3s tick. Sleeping
+	// the delay after each run would take at least 4.5s.
+	if elapsed > 4*time.Second {
+		t.Errorf("Rate mode took %v, runs were not started at a fixed rate", elapsed)
+	}
+}
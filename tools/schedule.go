@@ -0,0 +1,334 @@
+package tools
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule computes the fire times of a job
+type Schedule interface {
+	// Next returns the first fire time strictly after t, or the zero time if there is none
+	Next(t time.Time) time.Time
+}
+
+// everySchedule fires at a constant interval
+type everySchedule struct {
+	interval time.Duration
+}
+
+func (s everySchedule) Next(t time.Time) time.Time {
+	return t.Add(s.interval).Truncate(time.Second)
+}
+
+// cronSchedule fires at the times matched by a cron expression
+type cronSchedule struct {
+	second, minute, hour, dom, month, dow uint64
+	loc                                   *time.Location
+}
+
+type cronField struct {
+	min, max int
+	names    map[string]int
+}
+
+var (
+	secondField = cronField{0, 59, nil}
+	minuteField = cronField{0, 59, nil}
+	hourField   = cronField{0, 23, nil}
+	domField    = cronField{1, 31, nil}
+	monthField  = cronField{1, 12, map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	dowField = cronField{0, 7, map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+// starBit marks a field that was written as * so day matching can follow cron rules
+const starBit = 1 << 63
+
+var scheduleShortcuts = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// ParseSchedule parses a 5 or 6 field cron expression or one of the @ shortcuts.
+// The six field form starts with a seconds field. Times are evaluated in loc.
+func ParseSchedule(spec string, loc *time.Location) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if loc == nil {
+		loc = time.Local
+	}
+
+	if strings.HasPrefix(spec, "@every ") {
+		d, err := time.ParseDuration(strings.TrimSpace(strings.TrimPrefix(spec, "@every ")))
+		if err != nil {
+			return nil, fmt.Errorf("invalid @every interval: %w", err)
+		}
+		if d < time.Second {
+			return nil, fmt.Errorf("@every interval must be at least one second")
+		}
+		return everySchedule{interval: d}, nil
+	}
+	if expanded, ok := scheduleShortcuts[spec]; ok {
+		spec = expanded
+	} else if strings.HasPrefix(spec, "@") {
+		return nil, fmt.Errorf("unknown schedule shortcut %q", spec)
+	}
+
+	fields := strings.Fields(spec)
+	switch len(fields) {
+	case 5:
+		fields = append([]string{"0"}, fields...)
+	case 6:
+	default:
+		return nil, fmt.Errorf("expected 5 or 6 fields in schedule %q, got %d", spec, len(fields))
+	}
+
+	s := &cronSchedule{loc: loc}
+	var err error
+	targets := []struct {
+		bits  *uint64
+		field cronField
+		name  string
+	}{
+		{&s.second, secondField, "second"},
+		{&s.minute, minuteField, "minute"},
+		{&s.hour, hourField, "hour"},
+		{&s.dom, domField, "day of month"},
+		{&s.month, monthField, "month"},
+		{&s.dow, dowField, "day of week"},
+	}
+	for i, target := range targets {
+		if *target.bits, err = parseCronField(fields[i], target.field); err != nil {
+			return nil, fmt.Errorf("invalid %s field: %w", target.name, err)
+		}
+	}
+
+	// Sunday can be written as 0 or 7
+	if s.dow&(1<<7) != 0 {
+		s.dow = (s.dow | 1) &^ (1 << 7)
+	}
+	return s, nil
+}
+
+// parseCronField converts a comma separated cron field into a bit set
+func parseCronField(expr string, field cronField) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(expr, ",") {
+		b, err := parseCronRange(part, field)
+		if err != nil {
+			return 0, err
+		}
+		bits |= b
+	}
+	return bits, nil
+}
+
+// parseCronRange parses a single element such as *, 5, 1-5, */10 or 10-40/5
+func parseCronRange(expr string, field cronField) (uint64, error) {
+	rangePart, stepPart, hasStep := strings.Cut(expr, "/")
+	step := 1
+	if hasStep {
+		var err error
+		step, err = strconv.Atoi(stepPart)
+		if err != nil || step <= 0 {
+			return 0, fmt.Errorf("invalid step %q", stepPart)
+		}
+	}
+
+	var start, end int
+	var extra uint64
+	switch {
+	case rangePart == "*" || rangePart == "?":
+		start, end = field.min, field.max
+		if field.max == 7 {
+			end = 6
+		}
+		if !hasStep {
+			extra = starBit
+		}
+	case strings.Contains(rangePart, "-"):
+		lo, hi, _ := strings.Cut(rangePart, "-")
+		var err error
+		if start, err = parseCronValue(lo, field); err != nil {
+			return 0, err
+		}
+		if end, err = parseCronValue(hi, field); err != nil {
+			return 0, err
+		}
+	default:
+		var err error
+		if start, err = parseCronValue(rangePart, field); err != nil {
+			return 0, err
+		}
+		end = start
+		if hasStep {
+			end = field.max
+		}
+	}
+
+	if start > end {
+		return 0, fmt.Errorf("range %q is reversed", rangePart)
+	}
+
+	var bits uint64
+	for v := start; v <= end; v += step {
+		bits |= 1 << uint(v)
+	}
+	return bits | extra, nil
+}
+
+// parseCronValue parses a number or a month/day name within the bounds of the field
+func parseCronValue(s string, field cronField) (int, error) {
+	if v, ok := field.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", s)
+	}
+	if v < field.min || v > field.max {
+		return 0, fmt.Errorf("value %d out of range [%d, %d]", v, field.min, field.max)
+	}
+	return v, nil
+}
+
+func (s *cronSchedule) Next(t time.Time) time.Time {
+	origLoc := t.Location()
+	t = t.In(s.loc)
+	t = t.Add(time.Second - time.Duration(t.Nanosecond()))
+
+	// Give up if nothing matches within a few years, e.g. for 30 February
+	yearLimit := t.Year() + 5
+	added := false
+
+wrap:
+	if t.Year() > yearLimit {
+		return time.Time{}
+	}
+
+	for 1<<uint(t.Month())&s.month == 0 {
+		if !added {
+			added = true
+			t = time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, s.loc)
+		}
+		t = t.AddDate(0, 1, 0)
+		if t.Month() == time.January {
+			goto wrap
+		}
+	}
+
+	for !s.dayMatches(t) {
+		if !added {
+			added = true
+			t = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, s.loc)
+		}
+		t = t.AddDate(0, 0, 1)
+		// Daylight saving changes can move midnight, so realign to the start of the day
+		if t.Hour() != 0 {
+			if t.Hour() > 12 {
+				t = t.Add(time.Duration(24-t.Hour()) * time.Hour)
+			} else {
+				t = t.Add(time.Duration(-t.Hour()) * time.Hour)
+			}
+		}
+		if t.Day() == 1 {
+			goto wrap
+		}
+	}
+
+	for 1<<uint(t.Hour())&s.hour == 0 {
+		if !added {
+			added = true
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, s.loc)
+		}
+		t = t.Add(time.Hour)
+		if t.Hour() == 0 {
+			goto wrap
+		}
+	}
+
+	for 1<<uint(t.Minute())&s.minute == 0 {
+		if !added {
+			added = true
+			t = t.Truncate(time.Minute)
+		}
+		t = t.Add(time.Minute)
+		if t.Minute() == 0 {
+			goto wrap
+		}
+	}
+
+	for 1<<uint(t.Second())&s.second == 0 {
+		if !added {
+			added = true
+			t = t.Truncate(time.Second)
+		}
+		t = t.Add(time.Second)
+		if t.Second() == 0 {
+			goto wrap
+		}
+	}
+
+	return t.In(origLoc)
+}
+
+// dayMatches applies the cron rule that restricted day-of-month and day-of-week fields are ORed
+func (s *cronSchedule) dayMatches(t time.Time) bool {
+	domMatch := 1<<uint(t.Day())&s.dom != 0
+	dowMatch := 1<<uint(t.Weekday())&s.dow != 0
+	if s.dom&starBit != 0 || s.dow&starBit != 0 {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+// scheduleState tracks the next fire time and applies the missed-run policy
+type scheduleState struct {
+	schedule Schedule
+	missed   string
+	next     time.Time
+}
+
+func newScheduleState(schedule Schedule, missed string, now time.Time) *scheduleState {
+	return &scheduleState{schedule: schedule, missed: missed, next: schedule.Next(now)}
+}
+
+// advance moves to the next fire time after a run that finished at now.
+// Fire times that passed while the command was running are skipped, run once
+// immediately, or all replayed, depending on the missed-run policy.
+func (s *scheduleState) advance(now time.Time) time.Time {
+	following := s.schedule.Next(s.next)
+	if following.IsZero() || following.After(now) {
+		s.next = following
+		return s.next
+	}
+
+	switch s.missed {
+	case "catch-up":
+		s.next = following
+	case "run-once":
+		s.next = now
+	default:
+		s.next = s.schedule.Next(now)
+	}
+	return s.next
+}
+
+// ValidateMissedRuns checks the missed-run policy name
+func ValidateMissedRuns(policy string) error {
+	switch policy {
+	case "", "skip", "run-once", "catch-up":
+		return nil
+	}
+	return fmt.Errorf("invalid missed-run policy %q, expected skip, run-once or catch-up", policy)
+}
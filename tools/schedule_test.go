@@ -0,0 +1,117 @@
+package tools
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseScheduleInvalid(t *testing.T) {
+	specs := []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"10-5 * * * *",
+		"@sometimes",
+		"@every 100ms",
+		"@every soon",
+	}
+
+	for _, spec := range specs {
+		if _, err := ParseSchedule(spec, time.UTC); err == nil {
+			t.Errorf("ParseSchedule(%q) expected error", spec)
+		}
+	}
+}
+
+func TestScheduleNext(t *testing.T) {
+	from := time.Date(2024, time.March, 15, 10, 20, 30, 0, time.UTC) // Friday
+	tests := []struct {
+		spec     string
+		expected time.Time
+	}{
+		{"* * * * *", time.Date(2024, time.March, 15, 10, 21, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2024, time.March, 15, 10, 30, 0, 0, time.UTC)},
+		{"0 9 * * *", time.Date(2024, time.March, 16, 9, 0, 0, 0, time.UTC)},
+		{"30 8 * * mon-fri", time.Date(2024, time.March, 18, 8, 30, 0, 0, time.UTC)},
+		{"0 0 1 jan *", time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2024, time.March, 17, 0, 0, 0, 0, time.UTC)},
+		{"0 0 13 * 5", time.Date(2024, time.March, 22, 0, 0, 0, 0, time.UTC)},
+		{"45 */10 * * * *", time.Date(2024, time.March, 15, 10, 20, 45, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2028, time.February, 29, 0, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2024, time.March, 15, 11, 0, 0, 0, time.UTC)},
+		{"@every 5m", time.Date(2024, time.March, 15, 10, 25, 30, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			s, err := ParseSchedule(tt.spec, time.UTC)
+			if err != nil {
+				t.Fatalf("ParseSchedule(%q) error: %v", tt.spec, err)
+			}
+			if got := s.Next(from); !got.Equal(tt.expected) {
+				t.Errorf("Next() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestScheduleNextImpossible(t *testing.T) {
+	s, err := ParseSchedule("0 0 30 2 *", time.UTC)
+	if err != nil {
+		t.Fatalf("ParseSchedule error: %v", err)
+	}
+	if got := s.Next(time.Now()); !got.IsZero() {
+		t.Errorf("Next() for 30 February = %v, want zero time", got)
+	}
+}
+
+func TestScheduleTimezone(t *testing.T) {
+	loc, err := time.LoadLocation("Asia/Tehran")
+	if err != nil {
+		t.Skip("time zone database not available")
+	}
+	s, err := ParseSchedule("0 9 * * *", loc)
+	if err != nil {
+		t.Fatalf("ParseSchedule error: %v", err)
+	}
+	from := time.Date(2024, time.March, 15, 0, 0, 0, 0, time.UTC)
+	expected := time.Date(2024, time.March, 15, 9, 0, 0, 0, loc)
+	if got := s.Next(from); !got.Equal(expected) {
+		t.Errorf("Next() = %v, want %v", got, expected)
+	}
+}
+
+func TestScheduleMissedRuns(t *testing.T) {
+	s, _ := ParseSchedule("@every 1m", time.UTC)
+	start := time.Date(2024, time.March, 15, 10, 0, 0, 0, time.UTC)
+	// The run fired at 10:01 and took three and a half minutes
+	finished := start.Add(4*time.Minute + 30*time.Second)
+
+	tests := []struct {
+		policy   string
+		expected time.Time
+	}{
+		{"skip", start.Add(5*time.Minute + 30*time.Second)},
+		{"run-once", finished},
+		{"catch-up", start.Add(2 * time.Minute)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			state := newScheduleState(s, tt.policy, start)
+			if got := state.advance(finished); !got.Equal(tt.expected) {
+				t.Errorf("advance() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+
+	state := newScheduleState(s, "skip", start)
+	if got := state.advance(start.Add(90 * time.Second)); !got.Equal(start.Add(2 * time.Minute)) {
+		t.Errorf("advance() without missed runs = %v, want %v", got, start.Add(2*time.Minute))
+	}
+}
@@ -0,0 +1,41 @@
+package tools
+
+import (
+	"syscall"
+	"testing"
+)
+
+func TestParseSignal(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected syscall.Signal
+	}{
+		{"TERM", syscall.SIGTERM},
+		{"SIGTERM", syscall.SIGTERM},
+		{"sigint", syscall.SIGINT},
+		{"KILL", syscall.SIGKILL},
+		{"9", syscall.SIGKILL},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sig, err := ParseSignal(tt.name)
+			if err != nil {
+				t.Fatalf("ParseSignal(%q) error: %v", tt.name, err)
+			}
+			if sig != tt.expected {
+				t.Errorf("ParseSignal(%q) = %v, want %v", tt.name, sig, tt.expected)
+			}
+		})
+	}
+
+	if _, err := ParseSignal("NOPE"); err == nil {
+		t.Error("Expected error for unknown signal")
+	}
+}
+
+func TestSignalName(t *testing.T) {
+	if got := signalName(syscall.SIGTERM); got != "SIGTERM" {
+		t.Errorf("signalName(SIGTERM) = %s, want SIGTERM", got)
+	}
+}
@@ -0,0 +1,19 @@
+//go:build windows
+
+package tools
+
+import (
+	"os"
+	"syscall"
+)
+
+var signalNames = map[string]syscall.Signal{
+	"INT":  syscall.SIGINT,
+	"KILL": syscall.SIGKILL,
+	"TERM": syscall.SIGTERM,
+}
+
+// exitSignal always reports false, Windows processes are not terminated by signals
+func exitSignal(state *os.ProcessState) (syscall.Signal, bool) {
+	return 0, false
+}
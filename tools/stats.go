@@ -0,0 +1,175 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// JobStats summarizes the recorded runs of a job
+type JobStats struct {
+	JobID                string     `json:"job_id"`
+	Command              string     `json:"command"`
+	Runs                 int        `json:"runs"`
+	Successes            int        `json:"successes"`
+	Failures             int        `json:"failures"`
+	SuccessRate          float64    `json:"success_rate"`
+	P50MS                int64      `json:"p50_ms"`
+	P95MS                int64      `json:"p95_ms"`
+	P99MS                int64      `json:"p99_ms"`
+	LongestSuccessStreak int        `json:"longest_success_streak"`
+	LongestFailureStreak int        `json:"longest_failure_streak"`
+	MTBFMS               int64      `json:"mtbf_ms"` // observed period divided by the number of failures
+	LastFailure          *time.Time `json:"last_failure,omitempty"`
+	LastFailureReason    string     `json:"last_failure_reason,omitempty"`
+}
+
+// computeStats summarizes run records, which must be sorted oldest first
+func computeStats(jobID string, records []RunRecord) JobStats {
+	stats := JobStats{JobID: jobID, Runs: len(records)}
+	if len(records) == 0 {
+		return stats
+	}
+	stats.Command = records[len(records)-1].Command
+
+	var durations []int64
+	successStreak, failureStreak := 0, 0
+	for _, rec := range records {
+		durations = append(durations, rec.DurationMS)
+		if rec.Success {
+			stats.Successes++
+			successStreak++
+			failureStreak = 0
+		} else {
+			stats.Failures++
+			failureStreak++
+			successStreak = 0
+			start := rec.Start
+			stats.LastFailure = &start
+			stats.LastFailureReason = failureReason(rec)
+		}
+		if successStreak > stats.LongestSuccessStreak {
+			stats.LongestSuccessStreak = successStreak
+		}
+		if failureStreak > stats.LongestFailureStreak {
+			stats.LongestFailureStreak = failureStreak
+		}
+	}
+	stats.SuccessRate = float64(stats.Successes) / float64(stats.Runs)
+
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+	stats.P50MS = percentile(durations, 50)
+	stats.P95MS = percentile(durations, 95)
+	stats.P99MS = percentile(durations, 99)
+
+	if stats.Failures > 0 {
+		observed := records[len(records)-1].End.Sub(records[0].Start)
+		stats.MTBFMS = observed.Milliseconds() / int64(stats.Failures)
+	}
+	return stats
+}
+
+// percentile returns the nearest-rank percentile of sorted values
+func percentile(sorted []int64, p int) int64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// failureReason describes why a recorded run failed
+func failureReason(rec RunRecord) string {
+	switch {
+	case rec.Matched == "fail":
+		return fmt.Sprintf("output matched --fail-on-output: %s", rec.MatchedLine)
+	case rec.TimedOut:
+		return fmt.Sprintf("timed out, stopped with %s", rec.Signal)
+	case rec.Signal != "":
+		return fmt.Sprintf("killed by %s", rec.Signal)
+	}
+	return fmt.Sprintf("exit status %d", rec.ExitCode)
+}
+
+// ReadStats computes the statistics of the runs within the window, 0 for all
+// recorded runs. With an empty query the statistics of every job with a history
+// are returned, otherwise those of the job given by name, ID or ID prefix.
+func ReadStats(dir string, query string, window time.Duration) ([]JobStats, error) {
+	jobIDs := historyJobIDs(dir)
+	if query != "" {
+		jobID, err := resolveJobIDWith(query, jobIDs)
+		if err != nil {
+			return nil, err
+		}
+		jobIDs = []string{jobID}
+	}
+
+	var cutoff time.Time
+	if window > 0 {
+		cutoff = time.Now().Add(-window)
+	}
+
+	var all []JobStats
+	for _, jobID := range jobIDs {
+		records, err := readHistoryFile(filepath.Join(dir, jobID+".jsonl"))
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil, fmt.Errorf("no history stored for job %s", jobID)
+			}
+			return nil, err
+		}
+		i := 0
+		for i < len(records) && records[i].Start.Before(cutoff) {
+			i++
+		}
+		all = append(all, computeStats(jobID, records[i:]))
+	}
+	return all, nil
+}
+
+// PrintStats writes job statistics as a table, or as JSON when asJSON is set
+func PrintStats(w io.Writer, stats []JobStats, asJSON bool) error {
+	if asJSON {
+		if stats == nil {
+			stats = []JobStats{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.SetEscapeHTML(false)
+		return enc.Encode(stats)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "JOB-ID\tRUNS\tOK\tFAILED\tSUCCESS\tP50\tP95\tP99\tOK-STREAK\tFAIL-STREAK\tMTBF\tLAST-FAILURE")
+	for _, s := range stats {
+		rate, mtbf, lastFailure := "-", "-", "-"
+		if s.Runs > 0 {
+			rate = fmt.Sprintf("%.1f%%", s.SuccessRate*100)
+		}
+		if s.Failures > 0 {
+			mtbf = (time.Duration(s.MTBFMS) * time.Millisecond).Round(time.Second).String()
+			lastFailure = fmt.Sprintf("%s (%s)", s.LastFailure.Local().Format("2006-01-02 15:04:05"), s.LastFailureReason)
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%s\t%s\t%s\t%s\t%d\t%d\t%s\t%s\n",
+			s.JobID, s.Runs, s.Successes, s.Failures, rate,
+			formatStatDuration(s.P50MS), formatStatDuration(s.P95MS), formatStatDuration(s.P99MS),
+			s.LongestSuccessStreak, s.LongestFailureStreak, mtbf, lastFailure)
+	}
+	return tw.Flush()
+}
+
+func formatStatDuration(ms int64) string {
+	d := time.Duration(ms) * time.Millisecond
+	if d >= time.Second {
+		return d.Round(10 * time.Millisecond).String()
+	}
+	return d.String()
+}
@@ -0,0 +1,142 @@
+package tools
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPercentile(t *testing.T) {
+	var values []int64
+	for i := int64(1); i <= 100; i++ {
+		values = append(values, i)
+	}
+	tests := []struct {
+		p    int
+		want int64
+	}{
+		{50, 50},
+		{95, 95},
+		{99, 99},
+		{100, 100},
+	}
+	for _, tt := range tests {
+		if got := percentile(values, tt.p); got != tt.want {
+			t.Errorf("percentile(1..100, %d) = %d, want %d", tt.p, got, tt.want)
+		}
+	}
+	if got := percentile([]int64{7}, 99); got != 7 {
+		t.Errorf("percentile of a single value = %d, want 7", got)
+	}
+	if got := percentile(nil, 50); got != 0 {
+		t.Errorf("percentile of no values = %d, want 0", got)
+	}
+}
+
+func TestComputeStats(t *testing.T) {
+	start := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	results := []bool{true, true, false, false, false, true, true, true, true, false}
+	var records []RunRecord
+	for i, ok := range results {
+		rec := RunRecord{
+			Run:        i + 1,
+			Start:      start.Add(time.Duration(i) * time.Hour),
+			End:        start.Add(time.Duration(i)*time.Hour + time.Minute),
+			DurationMS: int64(i+1) * 1000,
+			Success:    ok,
+			ExitCode:   1,
+		}
+		records = append(records, rec)
+	}
+	records[9].TimedOut = true
+	records[9].Signal = "SIGTERM"
+
+	s := computeStats("job", records)
+	if s.Runs != 10 || s.Successes != 6 || s.Failures != 4 || s.SuccessRate != 0.6 {
+		t.Errorf("counts = %d/%d/%d rate %v", s.Runs, s.Successes, s.Failures, s.SuccessRate)
+	}
+	if s.P50MS != 5000 || s.P95MS != 10000 || s.P99MS != 10000 {
+		t.Errorf("percentiles = %d/%d/%d", s.P50MS, s.P95MS, s.P99MS)
+	}
+	if s.LongestSuccessStreak != 4 || s.LongestFailureStreak != 3 {
+		t.Errorf("streaks = %d/%d, want 4/3", s.LongestSuccessStreak, s.LongestFailureStreak)
+	}
+	// 9h01m observed with 4 failures
+	if want := (9*time.Hour + time.Minute).Milliseconds() / 4; s.MTBFMS != want {
+		t.Errorf("MTBF = %dms, want %dms", s.MTBFMS, want)
+	}
+	if s.LastFailure == nil || !s.LastFailure.Equal(records[9].Start) || s.LastFailureReason != "timed out, stopped with SIGTERM" {
+		t.Errorf("last failure = %v %q", s.LastFailure, s.LastFailureReason)
+	}
+
+	empty := computeStats("job", nil)
+	if empty.Runs != 0 || empty.LastFailure != nil {
+		t.Errorf("stats of no runs = %+v", empty)
+	}
+}
+
+func TestFailureReason(t *testing.T) {
+	tests := []struct {
+		rec  RunRecord
+		want string
+	}{
+		{RunRecord{ExitCode: 3}, "exit status 3"},
+		{RunRecord{ExitCode: 143, Signal: "SIGTERM"}, "killed by SIGTERM"},
+		{RunRecord{ExitCode: 124, TimedOut: true, Signal: "SIGTERM"}, "timed out, stopped with SIGTERM"},
+		{RunRecord{Matched: "fail", MatchedLine: "ERROR"}, "output matched --fail-on-output: ERROR"},
+	}
+	for _, tt := range tests {
+		if got := failureReason(tt.rec); got != tt.want {
+			t.Errorf("failureReason(%+v) = %q, want %q", tt.rec, got, tt.want)
+		}
+	}
+}
+
+func TestReadStats(t *testing.T) {
+	setupTestLogFile(t)
+	dir := t.TempDir()
+	for _, jobID := range []string{"3f2a11", "a91c33"} {
+		h, err := openHistoryStore(HistoryConfig{Dir: dir}, jobID)
+		if err != nil {
+			t.Fatalf("openHistoryStore() error: %v", err)
+		}
+		now := time.Now()
+		h.append(RunRecord{JobID: jobID, Run: 1, Start: now.Add(-48 * time.Hour), End: now.Add(-48 * time.Hour)})
+		h.append(RunRecord{JobID: jobID, Run: 2, Start: now.Add(-time.Hour), End: now.Add(-time.Hour), Success: true})
+	}
+
+	all, err := ReadStats(dir, "", 0)
+	if err != nil || len(all) != 2 {
+		t.Fatalf("ReadStats() = %d jobs, %v, want 2 jobs", len(all), err)
+	}
+
+	one, err := ReadStats(dir, "a9", 24*time.Hour)
+	if err != nil || len(one) != 1 {
+		t.Fatalf("ReadStats(a9) = %v, %v", one, err)
+	}
+	if one[0].JobID != "a91c33" || one[0].Runs != 1 || one[0].Failures != 0 {
+		t.Errorf("window was not applied: %+v", one[0])
+	}
+
+	if _, err := ReadStats(filepath.Join(dir, "missing"), "zz", 0); err == nil {
+		t.Error("ReadStats() with an unknown job should fail")
+	}
+
+	var table bytes.Buffer
+	if err := PrintStats(&table, all, false); err != nil {
+		t.Fatalf("PrintStats() error: %v", err)
+	}
+	if lines := strings.Split(strings.TrimSpace(table.String()), "\n"); len(lines) != 3 || !strings.Contains(lines[1], "50.0%") {
+		t.Errorf("unexpected table:\n%s", table.String())
+	}
+
+	var out bytes.Buffer
+	PrintStats(&out, one, true)
+	var decoded []JobStats
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil || len(decoded) != 1 || decoded[0].JobID != "a91c33" {
+		t.Errorf("JSON output did not round-trip: %v\n%s", err, out.String())
+	}
+}